@@ -0,0 +1,435 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v2"
+)
+
+const serviceAccountUsernamePrefix = "system:serviceaccount:"
+
+// AuditLog holds the API usage of each subject, as recorded in Kubernetes API audit logs
+type AuditLog struct {
+	usage  map[KindNamespacedName]map[APIUsage]int // map[subject]map[usage]count
+	groups map[KindNamespacedName][]string         // groups the subject was a member of when making the requests
+}
+
+// auditEvent contains the fields of an audit.k8s.io/v1 Event that rback needs
+type auditEvent struct {
+	Stage string `json:"stage"`
+	Verb  string `json:"verb"`
+	User  struct {
+		Username string   `json:"username"`
+		Groups   []string `json:"groups"`
+	} `json:"user"`
+	ObjectRef *struct {
+		Resource    string `json:"resource"`
+		Namespace   string `json:"namespace"`
+		APIGroup    string `json:"apiGroup"`
+		Subresource string `json:"subresource"`
+	} `json:"objectRef"`
+	ResponseStatus *struct {
+		Code int `json:"code"`
+	} `json:"responseStatus"`
+}
+
+// loadAuditLogs reads audit events (JSON lines, as written by the apiserver's log backend) from the given files
+func loadAuditLogs(fileNames []string) (*AuditLog, error) {
+	log := &AuditLog{
+		usage:  map[KindNamespacedName]map[APIUsage]int{},
+		groups: map[KindNamespacedName][]string{},
+	}
+	for _, fileName := range fileNames {
+		file, err := os.Open(fileName)
+		if err != nil {
+			return nil, err
+		}
+		err = log.read(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fileName, err)
+		}
+	}
+	return log, nil
+}
+
+func (l *AuditLog) read(reader io.Reader) error {
+	decoder := json.NewDecoder(reader)
+	for decoder.More() {
+		var event auditEvent
+		if err := decoder.Decode(&event); err != nil {
+			return err
+		}
+		l.record(event)
+	}
+	return nil
+}
+
+// record adds the usage of a completed resource request to the log. Each request is logged at several stages, so
+// only one of them is counted. Non-resource requests and requests that were denied are ignored.
+func (l *AuditLog) record(event auditEvent) {
+	if event.Stage != "" && event.Stage != "ResponseComplete" {
+		return
+	}
+	if event.ObjectRef == nil || event.ObjectRef.Resource == "" {
+		return
+	}
+	if event.ResponseStatus != nil && (event.ResponseStatus.Code == 401 || event.ResponseStatus.Code == 403) {
+		return
+	}
+
+	subject := usernameToSubject(event.User.Username)
+	resource := event.ObjectRef.Resource
+	if event.ObjectRef.Subresource != "" {
+		resource += "/" + event.ObjectRef.Subresource
+	}
+	usage := APIUsage{
+		verb:      event.Verb,
+		apiGroup:  event.ObjectRef.APIGroup,
+		resource:  resource,
+		namespace: event.ObjectRef.Namespace,
+	}
+
+	if l.usage[subject] == nil {
+		l.usage[subject] = map[APIUsage]int{}
+	}
+	l.usage[subject][usage]++
+	for _, group := range event.User.Groups {
+		if !contains(l.groups[subject], group) {
+			l.groups[subject] = append(l.groups[subject], group)
+		}
+	}
+}
+
+// usernameToSubject turns "system:serviceaccount:NAMESPACE:NAME" into a ServiceAccount and anything else into a User
+func usernameToSubject(username string) KindNamespacedName {
+	if strings.HasPrefix(username, serviceAccountUsernamePrefix) {
+		parts := strings.SplitN(strings.TrimPrefix(username, serviceAccountUsernamePrefix), ":", 2)
+		if len(parts) == 2 {
+			return KindNamespacedName{"ServiceAccount", NamespacedName{parts[0], parts[1]}}
+		}
+	}
+	return KindNamespacedName{"User", NamespacedName{"", username}}
+}
+
+func (l *AuditLog) subjects() []KindNamespacedName {
+	subjects := []KindNamespacedName{}
+	for subject := range l.usage {
+		subjects = append(subjects, subject)
+	}
+	sort.Slice(subjects, func(i, j int) bool {
+		return subjects[i].String() < subjects[j].String()
+	})
+	return subjects
+}
+
+func (l *AuditLog) sortedUsage(subject KindNamespacedName) []APIUsage {
+	usage := []APIUsage{}
+	for u := range l.usage[subject] {
+		usage = append(usage, u)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		return usage[i].String() < usage[j].String()
+	})
+	return usage
+}
+
+func (u APIUsage) String() string {
+	result := u.verb + " " + u.resource
+	if u.apiGroup != "" {
+		result += "." + u.apiGroup
+	}
+	return result
+}
+
+func (u APIUsage) scope() string {
+	if u.namespace == "" {
+		return "cluster-wide"
+	}
+	return "in " + u.namespace
+}
+
+// Grant is an access rule granted to a subject through a binding
+type Grant struct {
+	binding Binding
+	rule    Rule
+}
+
+// grantsTo returns all access rules granted to the subject directly or through one of its groups
+func (r *Rback) grantsTo(subject KindNamespacedName, groups []string) []Grant {
+	grants := []Grant{}
+	for _, bindings := range r.permissions.RoleBindings {
+		for _, binding := range bindings {
+			if !bindsSubject(binding, subject, groups) {
+				continue
+			}
+			if roles, found := r.permissions.Roles[binding.role.namespace]; found {
+				if role, found := roles[binding.role.name]; found {
+					for _, rule := range role.rules {
+						grants = append(grants, Grant{binding, rule})
+					}
+				}
+			}
+		}
+	}
+	sort.Slice(grants, func(i, j int) bool {
+		return bindingRef(grants[i].binding).String() < bindingRef(grants[j].binding).String()
+	})
+	return grants
+}
+
+func bindsSubject(binding Binding, subject KindNamespacedName, groups []string) bool {
+	for _, s := range binding.subjects {
+		if s == subject || (s.kind == "Group" && contains(groups, s.name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// allows returns true if the binding's scope includes the namespace of the usage and the rule allows it
+func (g Grant) allows(u APIUsage) bool {
+	return (g.binding.namespace == "" || g.binding.namespace == u.namespace) && g.rule.allows(u)
+}
+
+// auditSubjectSelected returns true if the subject is a ServiceAccount in one of the selected namespaces or is bound
+// (directly or through one of its groups) by a binding in one of them. Users and Groups have no namespace, so they're
+// only selected through their bindings.
+func (r *Rback) auditSubjectSelected(subject KindNamespacedName, groups []string) bool {
+	if r.namespaceSelected(subject.namespace) {
+		return true
+	}
+	for ns, bindings := range r.permissions.RoleBindings {
+		if !r.namespaceSelected(ns) {
+			continue
+		}
+		for _, binding := range bindings {
+			if bindsSubject(binding, subject, groups) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// printAuditReport prints, for each subject in the audit log, the API usage and the grants that were never used
+func (r *Rback) printAuditReport(w io.Writer, log *AuditLog) {
+	for _, subject := range log.subjects() {
+		if !r.auditSubjectSelected(subject, log.groups[subject]) {
+			continue
+		}
+		usage := log.sortedUsage(subject)
+		grants := r.grantsTo(subject, log.groups[subject])
+
+		fmt.Fprintf(w, "%v\n", subject)
+		fmt.Fprintf(w, "  Used:\n")
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		for _, u := range usage {
+			granted := false
+			for _, grant := range grants {
+				if grant.allows(u) {
+					granted = true
+					break
+				}
+			}
+			fmt.Fprintf(tw, "    %v\t%s\t%d request(s)%s\n", u, u.scope(), log.usage[subject][u], iff(granted, "", "\t(not granted by any parsed binding)"))
+		}
+		tw.Flush()
+
+		fmt.Fprintf(w, "  Unused grants:\n")
+		unused := 0
+		for _, grant := range grants {
+			used := false
+			for _, u := range usage {
+				if grant.allows(u) {
+					used = true
+					break
+				}
+			}
+			if !used {
+				fmt.Fprintf(w, "    %v -> %v: %q\n", bindingRef(grant.binding), roleRef(grant.binding.role), grant.rule.toHumanReadableString())
+				unused++
+			}
+		}
+		if unused == 0 {
+			fmt.Fprintf(w, "    none\n")
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// AuditHits holds the number of logged requests that were allowed by each access rule, role, binding and subject-to-binding edge
+type AuditHits struct {
+	rules           map[NamespacedName][]int // map[role][ruleIndex]hits
+	roles           map[NamespacedName]int
+	bindings        map[NamespacedName]int
+	subjectBindings map[subjectBinding]int
+}
+
+type subjectBinding struct {
+	subject KindNamespacedName
+	binding NamespacedName
+}
+
+// roleHit identifies a request counted as a hit of a role (rule -1) or of one of its rules
+type roleHit struct {
+	role  NamespacedName
+	usage APIUsage
+	rule  int
+}
+
+// auditHits returns the hits of the audit log, computing them on first use. A request made by a member of a group
+// counts as a hit of the group's edge to the binding. A request allowed through several bindings of the same role counts
+// as a hit of each binding, but only once as a hit of the role and of each of its rules.
+func (r *Rback) auditHits() *AuditHits {
+	if r.auditHitCounts != nil {
+		return r.auditHitCounts
+	}
+	hits := &AuditHits{
+		rules:           map[NamespacedName][]int{},
+		roles:           map[NamespacedName]int{},
+		bindings:        map[NamespacedName]int{},
+		subjectBindings: map[subjectBinding]int{},
+	}
+	for subject, usage := range r.auditLog.usage {
+		groups := r.auditLog.groups[subject]
+		counted := map[roleHit]bool{}
+		for _, bindings := range r.permissions.RoleBindings {
+			for _, binding := range bindings {
+				if !bindsSubject(binding, subject, groups) {
+					continue
+				}
+				role, found := r.permissions.Roles[binding.role.namespace][binding.role.name]
+				if !found {
+					continue
+				}
+				// counted per rendered rule, since the rules nodes show the compacted rules with --compact-rules
+				rules := r.renderedRules(role)
+				ruleHits := hits.rules[binding.role]
+				if ruleHits == nil {
+					ruleHits = make([]int, len(rules))
+					hits.rules[binding.role] = ruleHits
+				}
+				for u, count := range usage {
+					allowed := false
+					for i, rule := range rules {
+						if (Grant{binding, rule}).allows(u) {
+							if hit := (roleHit{binding.role, u, i}); !counted[hit] {
+								ruleHits[i] += count
+								counted[hit] = true
+							}
+							allowed = true
+						}
+					}
+					if !allowed {
+						continue
+					}
+					if hit := (roleHit{binding.role, u, -1}); !counted[hit] {
+						hits.roles[binding.role] += count
+						counted[hit] = true
+					}
+					hits.bindings[binding.NamespacedName] += count
+					for _, s := range binding.subjects {
+						if s == subject || (s.kind == "Group" && contains(groups, s.name)) {
+							hits.subjectBindings[subjectBinding{s, binding.NamespacedName}] += count
+						}
+					}
+				}
+			}
+		}
+	}
+	r.auditHitCounts = hits
+	return hits
+}
+
+// ruleHits returns the number of logged requests allowed by the rule with the given index in the role
+func (r *Rback) ruleHits(role NamespacedName, ruleIndex int) int {
+	ruleHits := r.auditHits().rules[role]
+	if ruleHits == nil {
+		return 0
+	}
+	return ruleHits[ruleIndex]
+}
+
+func (r *Rback) roleHits(role NamespacedName) int {
+	if r.auditLog == nil {
+		return 0
+	}
+	return r.auditHits().roles[role]
+}
+
+func (r *Rback) bindingHits(binding NamespacedName) int {
+	if r.auditLog == nil {
+		return 0
+	}
+	return r.auditHits().bindings[binding]
+}
+
+func (r *Rback) subjectBindingHits(subject KindNamespacedName, binding NamespacedName) int {
+	if r.auditLog == nil {
+		return 0
+	}
+	return r.auditHits().subjectBindings[subjectBinding{subject, binding}]
+}
+
+type yamlRole struct {
+	APIVersion string       `yaml:"apiVersion"`
+	Kind       string       `yaml:"kind"`
+	Metadata   yamlMetadata `yaml:"metadata"`
+	Rules      []yamlRule   `yaml:"rules"`
+}
+
+type yamlMetadata struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// printMinimalRoles prints, for each subject, a ClusterRole with its cluster-wide usage and a Role per namespace it used
+func (r *Rback) printMinimalRoles(w io.Writer, log *AuditLog) error {
+	for _, subject := range log.subjects() {
+		if !r.auditSubjectSelected(subject, log.groups[subject]) {
+			continue
+		}
+		usageByNamespace := map[string][]APIUsage{}
+		namespaces := []string{}
+		for _, u := range log.sortedUsage(subject) {
+			if _, found := usageByNamespace[u.namespace]; !found {
+				namespaces = append(namespaces, u.namespace)
+			}
+			usageByNamespace[u.namespace] = append(usageByNamespace[u.namespace], u)
+		}
+		sort.Strings(namespaces)
+
+		for _, ns := range namespaces {
+			role := yamlRole{
+				APIVersion: "rbac.authorization.k8s.io/v1",
+				Kind:       iff(ns == "", "ClusterRole", "Role"),
+				Metadata:   yamlMetadata{Name: minimalRoleName(subject), Namespace: ns},
+				Rules:      toYAMLRules(minimalRules(usageByNamespace[ns])),
+			}
+			out, err := yaml.Marshal(role)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "---\n# Minimal %s for %v, based on audit logs\n%s", role.Kind, subject, out)
+		}
+	}
+	return nil
+}
+
+// minimalRoleName derives a valid object name from the subject (user names may contain characters like '@' or ':')
+func minimalRoleName(subject KindNamespacedName) string {
+	name := strings.Map(func(c rune) rune {
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '.' {
+			return c
+		}
+		return '-'
+	}, strings.ToLower(subject.name))
+	return strings.Trim(name, "-.") + "-minimal"
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+const (
+	cisPass   = "PASS"
+	cisFail   = "FAIL"
+	cisManual = "MANUAL"
+)
+
+// cisControl is a single control of section 5.1 (RBAC and Service Accounts) of the CIS Kubernetes Benchmark.
+// Controls without an evaluate func can't be checked from RBAC resources alone and must be assessed manually.
+type cisControl struct {
+	CheckInfo
+	evaluate func(r *Rback, control CheckInfo) []Finding
+}
+
+var cisControls = []cisControl{
+	{CheckInfo{"5.1.1", "Ensure that the cluster-admin role is only used where required"}, (*Rback).cisClusterAdminBindings},
+	{CheckInfo{"5.1.2", "Minimize access to secrets"}, grantingRules(func(rule Rule) bool {
+		return rule.grantsAny([]string{"get", "list", "watch"}, "secrets", "")
+	})},
+	{CheckInfo{"5.1.3", "Minimize wildcard use in Roles and ClusterRoles"}, grantingRules(func(rule Rule) bool {
+		return rule.hasWildcard()
+	})},
+	{CheckInfo{"5.1.4", "Minimize access to create pods"}, grantingRules(func(rule Rule) bool {
+		return rule.grants("create", "pods", "")
+	})},
+	{CheckInfo{"5.1.5", "Ensure that default service accounts are not actively used"}, (*Rback).cisDefaultServiceAccounts},
+	{CheckInfo{"5.1.6", "Ensure that Service Account Tokens are only mounted where necessary"}, nil},
+	{CheckInfo{"5.1.7", "Avoid use of system:masters group"}, (*Rback).cisSystemMastersBindings},
+	{CheckInfo{"5.1.8", "Limit use of the Bind, Impersonate and Escalate permissions in the Kubernetes cluster"}, grantingRules(func(rule Rule) bool {
+		return rule.grantsAny([]string{"bind", "impersonate", "escalate"}, "", "")
+	})},
+	{CheckInfo{"5.1.9", "Minimize access to create persistent volumes"}, grantingRules(func(rule Rule) bool {
+		return rule.grants("create", "persistentvolumes", "")
+	})},
+	{CheckInfo{"5.1.10", "Minimize access to the proxy sub-resource of nodes"}, grantingRules(func(rule Rule) bool {
+		return rule.grantsAny([]string{"get", "create", "update", "patch", "delete"}, "nodes/proxy", "")
+	})},
+	{CheckInfo{"5.1.11", "Minimize access to the approval sub-resource of certificatesigningrequests objects"}, grantingRules(func(rule Rule) bool {
+		return rule.grantsAny([]string{"update", "patch"}, "certificatesigningrequests/approval", "certificates.k8s.io")
+	})},
+	{CheckInfo{"5.1.12", "Minimize access to webhook configuration objects"}, grantingRules(func(rule Rule) bool {
+		verbs := []string{"create", "update", "patch", "delete"}
+		return rule.grantsAny(verbs, "validatingwebhookconfigurations", "admissionregistration.k8s.io") ||
+			rule.grantsAny(verbs, "mutatingwebhookconfigurations", "admissionregistration.k8s.io")
+	})},
+	{CheckInfo{"5.1.13", "Minimize access to the service account token creation"}, grantingRules(func(rule Rule) bool {
+		return rule.grants("create", "serviceaccounts/token", "")
+	})},
+}
+
+func cisChecks() []CheckInfo {
+	checks := []CheckInfo{}
+	for _, control := range cisControls {
+		checks = append(checks, control.CheckInfo)
+	}
+	return checks
+}
+
+// checkCIS evaluates all CIS controls that can be evaluated and returns a finding for each offending binding or role
+func (r *Rback) checkCIS() []Finding {
+	findings := []Finding{}
+	for _, control := range cisControls {
+		if control.evaluate != nil {
+			findings = append(findings, control.evaluate(r, control.CheckInfo)...)
+		}
+	}
+	sortFindings(findings)
+	return findings
+}
+
+// printCISReport prints the status of each control, followed by the offending objects of failed controls
+func printCISReport(w io.Writer, findings []Finding, sources map[KindNamespacedName]SourcePosition) {
+	counts := map[string]int{}
+	for _, control := range cisControls {
+		controlFindings := []Finding{}
+		for _, f := range findings {
+			if f.ruleID == control.id {
+				controlFindings = append(controlFindings, f)
+			}
+		}
+
+		status := cisPass
+		if control.evaluate == nil {
+			status = cisManual
+		} else if len(controlFindings) > 0 {
+			status = cisFail
+		}
+		counts[status]++
+
+		fmt.Fprintf(w, "[%s] %s %s\n", status, control.id, control.description)
+		for _, f := range controlFindings {
+			fmt.Fprintf(w, "        %v: %s", f.object, f.message)
+			if pos, found := sources[f.object]; found {
+				fmt.Fprintf(w, " (%v)", pos)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+	fmt.Fprintf(w, "\n%d passed, %d failed, %d to be checked manually\n", counts[cisPass], counts[cisFail], counts[cisManual])
+}
+
+// grantingRules returns an evaluate func reporting all roles with a matching access rule and all bindings referring to
+// them. The offending rules of roles in all namespaces are collected, so that RoleBindings in the selected namespaces
+// are reported for the ClusterRoles they refer to.
+func grantingRules(matches func(rule Rule) bool) func(r *Rback, control CheckInfo) []Finding {
+	return func(r *Rback, control CheckInfo) []Finding {
+		findings := []Finding{}
+		offendingRules := map[NamespacedName][]Rule{}
+		for _, roles := range r.permissions.Roles {
+			for _, role := range roles {
+				for _, rule := range role.rules {
+					if !matches(rule) {
+						continue
+					}
+					offendingRules[role.NamespacedName] = append(offendingRules[role.NamespacedName], rule)
+					if r.namespaceSelected(role.namespace) {
+						findings = append(findings, newCISFinding(control, roleRef(role.NamespacedName), fmt.Sprintf("grants %q", rule.toHumanReadableString())))
+					}
+				}
+			}
+		}
+		for _, bindings := range r.permissions.RoleBindings {
+			for _, binding := range bindings {
+				if !r.namespaceSelected(binding.namespace) {
+					continue
+				}
+				if rules, found := offendingRules[binding.role]; found && len(binding.subjects) > 0 {
+					findings = append(findings, newCISFinding(control, bindingRef(binding),
+						fmt.Sprintf("binds %s to %v (%d offending rule(s))", subjectList(binding.subjects), roleRef(binding.role), len(rules))))
+				}
+			}
+		}
+		return findings
+	}
+}
+
+func (r *Rback) cisClusterAdminBindings(control CheckInfo) []Finding {
+	findings := []Finding{}
+	for _, bindings := range r.permissions.RoleBindings {
+		for _, binding := range bindings {
+			if r.namespaceSelected(binding.namespace) && binding.role == (NamespacedName{"", "cluster-admin"}) {
+				findings = append(findings, newCISFinding(control, bindingRef(binding),
+					fmt.Sprintf("binds %s to ClusterRole cluster-admin", subjectList(binding.subjects))))
+			}
+		}
+	}
+	return findings
+}
+
+func (r *Rback) cisDefaultServiceAccounts(control CheckInfo) []Finding {
+	findings := []Finding{}
+	for _, bindings := range r.permissions.RoleBindings {
+		for _, binding := range bindings {
+			if !r.namespaceSelected(binding.namespace) {
+				continue
+			}
+			for _, subject := range binding.subjects {
+				if subject.kind == "ServiceAccount" && subject.name == "default" {
+					findings = append(findings, newCISFinding(control, bindingRef(binding), fmt.Sprintf("binds %v", subject)))
+				}
+			}
+		}
+	}
+	for ns, sas := range r.permissions.ServiceAccounts {
+		if sa, found := sas["default"]; found && r.namespaceSelected(ns) && automountsToken(sa) {
+			findings = append(findings, newCISFinding(control, KindNamespacedName{"ServiceAccount", NamespacedName{ns, "default"}},
+				"does not set automountServiceAccountToken: false"))
+		}
+	}
+	return findings
+}
+
+func (r *Rback) cisSystemMastersBindings(control CheckInfo) []Finding {
+	findings := []Finding{}
+	for _, bindings := range r.permissions.RoleBindings {
+		for _, binding := range bindings {
+			if !r.namespaceSelected(binding.namespace) {
+				continue
+			}
+			for _, subject := range binding.subjects {
+				if subject.kind == "Group" && subject.name == "system:masters" {
+					findings = append(findings, newCISFinding(control, bindingRef(binding), fmt.Sprintf("binds %v", subject)))
+				}
+			}
+		}
+	}
+	return findings
+}
+
+func newCISFinding(control CheckInfo, object KindNamespacedName, message string) Finding {
+	return Finding{
+		ruleID:      control.id,
+		description: control.description,
+		severity:    severityError,
+		message:     message,
+		object:      object,
+	}
+}
+
+// automountsToken returns true unless the ServiceAccount explicitly disables automounting of its token
+func automountsToken(serviceAccountJSON string) bool {
+	var sa struct {
+		AutomountServiceAccountToken *bool `json:"automountServiceAccountToken"`
+	}
+	if err := json.Unmarshal([]byte(serviceAccountJSON), &sa); err != nil {
+		return true
+	}
+	return sa.AutomountServiceAccountToken == nil || *sa.AutomountServiceAccountToken
+}
+
+func subjectList(subjects []KindNamespacedName) string {
+	if len(subjects) == 0 {
+		return "no subjects"
+	}
+	result := ""
+	for i, subject := range subjects {
+		if i > 0 {
+			result += ", "
+		}
+		result += subject.String()
+	}
+	return result
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// ruleScope is what a single access rule applies to once it's expanded to one API group and resource (or to one
+// non-resource URL)
+type ruleScope struct {
+	apiGroup       string
+	resource       string
+	resourceNames  string // comma-delimited and sorted, empty for all names
+	nonResourceURL string
+}
+
+// renderedRules returns the access rules of a role as they are rendered: compacted with --compact-rules, else verbatim
+func (r *Rback) renderedRules(role Role) []Rule {
+	if r.config.compactRules {
+		return compactRules(role.rules)
+	}
+	return role.rules
+}
+
+// compactRules normalizes access rules into fewer rules granting the same access. The rules are expanded into one
+// scope per API group and resource, and the verbs of equal scopes are merged. Verbs that a scope gets from a broader
+// scope (e.g. from a wildcard resource or API group) are removed, dropping scopes that are left without verbs. The
+// remaining scopes are collapsed again, first merging the API groups of equal resources and then the resources with
+// equal verbs and API groups. Lists containing a wildcard are collapsed to just the wildcard.
+func compactRules(rules []Rule) []Rule {
+	scopes := []ruleScope{}
+	verbs := map[ruleScope][]string{}
+	for _, rule := range rules {
+		for _, scope := range expandRule(rule) {
+			if _, found := verbs[scope]; !found {
+				scopes = append(scopes, scope)
+			}
+			verbs[scope] = collapseWildcard(uniqueValues(append(verbs[scope], rule.verbs...)))
+		}
+	}
+
+	remaining := []ruleScope{}
+	remainingVerbs := map[ruleScope][]string{}
+	for _, scope := range scopes {
+		scopeVerbs := verbs[scope]
+		for _, other := range scopes {
+			if other != scope && other.covers(scope) {
+				scopeVerbs = subtractVerbs(scopeVerbs, verbs[other])
+			}
+		}
+		if len(scopeVerbs) > 0 {
+			remaining = append(remaining, scope)
+			remainingVerbs[scope] = scopeVerbs
+		}
+	}
+	return collapseScopes(remaining, remainingVerbs)
+}
+
+// expandRule returns the scopes of a rule, one per API group and resource or one per non-resource URL
+func expandRule(rule Rule) []ruleScope {
+	scopes := []ruleScope{}
+	if len(rule.nonResourceURLs) > 0 {
+		for _, url := range collapseWildcard(uniqueValues(rule.nonResourceURLs)) {
+			scopes = append(scopes, ruleScope{nonResourceURL: url})
+		}
+		return scopes
+	}
+	names := uniqueValues(rule.resourceNames)
+	sort.Strings(names)
+	apiGroups := rule.apiGroups
+	if len(apiGroups) == 0 {
+		apiGroups = []string{""} // a missing apiGroups means the core API group
+	}
+	for _, apiGroup := range collapseWildcard(uniqueValues(apiGroups)) {
+		for _, resource := range collapseWildcard(uniqueValues(rule.resources)) {
+			scopes = append(scopes, ruleScope{apiGroup: apiGroup, resource: resource, resourceNames: strings.Join(names, ",")})
+		}
+	}
+	return scopes
+}
+
+// covers returns true if the scope includes everything the other scope applies to, following the wildcards the API
+// server supports: * for all API groups, resources and non-resource URLs, */SUBRESOURCE for a subresource of all
+// resources and a trailing * for non-resource URL prefixes
+func (s ruleScope) covers(other ruleScope) bool {
+	if s.nonResourceURL != "" || other.nonResourceURL != "" {
+		return s.nonResourceURL != "" && other.nonResourceURL != "" &&
+			(s.nonResourceURL == other.nonResourceURL ||
+				(strings.HasSuffix(s.nonResourceURL, "*") && strings.HasPrefix(other.nonResourceURL, strings.TrimSuffix(s.nonResourceURL, "*"))))
+	}
+	groupCovered := s.apiGroup == "*" || s.apiGroup == other.apiGroup
+	resourceCovered := s.resource == "*" || s.resource == other.resource ||
+		(strings.HasPrefix(s.resource, "*/") && strings.HasSuffix(other.resource, s.resource[1:]))
+	namesCovered := s.resourceNames == "" || (other.resourceNames != "" && containsAll(strings.Split(s.resourceNames, ","), strings.Split(other.resourceNames, ",")))
+	return groupCovered && resourceCovered && namesCovered
+}
+
+// collapseScopes turns scopes back into rules, in the order the scopes first appeared in
+func collapseScopes(scopes []ruleScope, verbs map[ruleScope][]string) []Rule {
+	rules := []Rule{}
+
+	// first the API groups of equal resources with equal verbs
+	resourceRules := []Rule{}
+	byResource := map[string]int{}
+	for _, scope := range scopes {
+		if scope.nonResourceURL != "" {
+			continue
+		}
+		key := strings.Join([]string{scope.resource, scope.resourceNames, valuesKey(verbs[scope])}, "|")
+		if i, found := byResource[key]; found {
+			resourceRules[i].apiGroups = append(resourceRules[i].apiGroups, scope.apiGroup)
+		} else {
+			byResource[key] = len(resourceRules)
+			rule := Rule{verbs: verbs[scope], apiGroups: []string{scope.apiGroup}, resources: []string{scope.resource}}
+			if scope.resourceNames != "" {
+				rule.resourceNames = strings.Split(scope.resourceNames, ",")
+			}
+			resourceRules = append(resourceRules, rule)
+		}
+	}
+
+	// then the resources with equal verbs and API groups
+	byGroups := map[string]int{}
+	for _, rule := range resourceRules {
+		rule.apiGroups = collapseWildcard(rule.apiGroups)
+		key := strings.Join([]string{valuesKey(rule.apiGroups), strings.Join(rule.resourceNames, ","), valuesKey(rule.verbs)}, "|")
+		if i, found := byGroups[key]; found {
+			rules[i].resources = append(rules[i].resources, rule.resources...)
+		} else {
+			byGroups[key] = len(rules)
+			rules = append(rules, rule)
+		}
+	}
+
+	// and last the non-resource URLs with equal verbs
+	urlRules := map[string]int{}
+	for _, scope := range scopes {
+		if scope.nonResourceURL == "" {
+			continue
+		}
+		key := valuesKey(verbs[scope])
+		if i, found := urlRules[key]; found {
+			rules[i].nonResourceURLs = append(rules[i].nonResourceURLs, scope.nonResourceURL)
+		} else {
+			urlRules[key] = len(rules)
+			rules = append(rules, Rule{verbs: verbs[scope], nonResourceURLs: []string{scope.nonResourceURL}})
+		}
+	}
+	return rules
+}
+
+// subtractVerbs returns the verbs that aren't granted already. A wildcard can't be narrowed down, so it's kept unless
+// it's granted as well.
+func subtractVerbs(verbs []string, granted []string) []string {
+	if contains(granted, "*") {
+		return nil
+	}
+	if contains(verbs, "*") {
+		return verbs
+	}
+	remaining := []string{}
+	for _, verb := range verbs {
+		if !contains(granted, verb) {
+			remaining = append(remaining, verb)
+		}
+	}
+	return remaining
+}
+
+// uniqueValues returns the values without duplicates, in the order they first appear in
+func uniqueValues(values []string) []string {
+	unique := []string{}
+	for _, value := range values {
+		if !contains(unique, value) {
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// collapseWildcard returns just the wildcard if the values contain it
+func collapseWildcard(values []string) []string {
+	if contains(values, "*") {
+		return []string{"*"}
+	}
+	return values
+}
+
+func containsAll(values []string, others []string) bool {
+	for _, other := range others {
+		if !contains(values, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// valuesKey returns a key for a set of values that doesn't depend on their order
+func valuesKey(values []string) string {
+	sorted := append([]string{}, values...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
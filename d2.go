@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// d2Shapes are the D2 shapes standing in for the dot shapes. D2 has no octagons, so bindings and roles are drawn as
+// hexagons, cluster-scoped ones stacked (style.multiple). Other shapes are drawn as rectangles.
+var d2Shapes = map[string]string{
+	diagramShapeBox:           "rectangle",
+	diagramShapeComponent:     "package",
+	diagramShapeOctagon:       "hexagon",
+	diagramShapeDoubleOctagon: "hexagon",
+	diagramShapeNote:          "page",
+}
+
+// writeD2 writes the diagram in the D2 language. D2 labels can't mix styles, so nodes with a bold line (e.g. a rule
+// matching a who-can query) are drawn bold as a whole.
+func (r *Rback) writeD2(w io.Writer) error {
+	d := r.genDiagram()
+	d.assignIDs()
+
+	t := d.theme
+	var out bytes.Buffer
+	if t.leftToRight() {
+		out.WriteString("direction: right\n")
+	}
+	if t.Background != "" {
+		fmt.Fprintf(&out, "style.fill: %s\n", d2Quote(t.Background))
+	}
+	writeD2Cluster(&out, t, d.root, "")
+	for _, edge := range d.edges {
+		fmt.Fprintf(&out, "%s %s %s", d2Path(edge.from), iff(edge.back, "<-", "->"), d2Path(edge.to))
+		if edge.label != "" {
+			fmt.Fprintf(&out, ": %s", d2Quote(edge.label))
+		}
+		if edge.faded {
+			fmt.Fprintf(&out, " {style.stroke: %s; style.stroke-dash: 3}", d2Quote(t.UnusedEdge.Color))
+		} else if t.Edge.Color != "" {
+			fmt.Fprintf(&out, " {style.stroke: %s}", d2Quote(t.Edge.Color))
+		}
+		out.WriteString("\n")
+	}
+	_, err := out.WriteTo(w)
+	return err
+}
+
+func writeD2Cluster(out *bytes.Buffer, t *Theme, c *DiagramCluster, indent string) {
+	for _, node := range c.sortedNodes() {
+		shape, found := d2Shapes[node.shape]
+		if !found {
+			shape = "rectangle"
+		}
+		fmt.Fprintf(out, "%s%s: %s {\n", indent, node.id, d2Label(node.lines))
+		fmt.Fprintf(out, "%s  shape: %s\n", indent, shape)
+		for _, style := range d2Style(node) {
+			fmt.Fprintf(out, "%s  style.%s\n", indent, style)
+		}
+		if node.tooltip != "" {
+			fmt.Fprintf(out, "%s  tooltip: %s\n", indent, d2Quote(node.tooltip))
+		}
+		if node.url != "" {
+			fmt.Fprintf(out, "%s  link: %s\n", indent, d2Quote(node.url))
+		}
+		fmt.Fprintf(out, "%s}\n", indent)
+	}
+	for _, cluster := range c.sortedClusters() {
+		fmt.Fprintf(out, "%s%s: %s {\n", indent, cluster.id, d2Quote(cluster.label))
+		if cluster.dashed {
+			fmt.Fprintf(out, "%s  style.stroke-dash: 3\n", indent)
+			if t.Namespace.Color != "" {
+				fmt.Fprintf(out, "%s  style.stroke: %s\n", indent, d2Quote(t.Namespace.Color))
+			}
+		}
+		if t.Background != "" {
+			fmt.Fprintf(out, "%s  style.fill: %s\n", indent, d2Quote(t.Background))
+		}
+		if t.FontColor != "" {
+			fmt.Fprintf(out, "%s  style.font-color: %s\n", indent, d2Quote(t.FontColor))
+		}
+		writeD2Cluster(out, t, cluster, indent+"  ")
+		fmt.Fprintf(out, "%s}\n", indent)
+	}
+}
+
+func d2Style(node *DiagramNode) []string {
+	style := []string{"fill: " + d2Quote(iff(node.fill == "", "#ffffff", node.fill))}
+	if node.fontColor != "" {
+		style = append(style, "font-color: "+d2Quote(node.fontColor))
+	}
+	if node.border != "" {
+		style = append(style, "stroke: "+d2Quote(node.border))
+	}
+	if node.dotted {
+		style = append(style, "stroke-dash: 2")
+	} else if node.dashed {
+		style = append(style, "stroke-dash: 5")
+	}
+	if node.bold {
+		style = append(style, "stroke-width: 3")
+	}
+	if node.shape == diagramShapeDoubleOctagon {
+		style = append(style, "multiple: true")
+	}
+	for _, line := range node.lines {
+		if line.bold {
+			style = append(style, "bold: true")
+			break
+		}
+	}
+	return style
+}
+
+func d2Label(lines []DiagramLine) string {
+	texts := []string{}
+	for _, line := range lines {
+		texts = append(texts, line.text)
+	}
+	return d2Quote(strings.Join(texts, "\n"))
+}
+
+// d2Quote returns a double-quoted D2 string
+func d2Quote(str string) string {
+	str = strings.ReplaceAll(str, `\`, `\\`)
+	str = strings.ReplaceAll(str, `"`, `\"`)
+	return `"` + strings.ReplaceAll(str, "\n", `\n`) + `"`
+}
+
+// d2Path returns the path of a node through the clusters it's nested in (e.g. "c1.c2.n3")
+func d2Path(node *DiagramNode) string {
+	path := node.id
+	for c := node.cluster; c.parent != nil; c = c.parent {
+		path = c.id + "." + path
+	}
+	return path
+}
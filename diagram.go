@@ -0,0 +1,452 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ranks of diagram nodes, i.e. the layers of a layered layout
+const (
+	diagramRankWorkload = iota
+	diagramRankSubject
+	diagramRankBinding
+	diagramRankRole
+	diagramRankRules
+)
+
+// shapes of diagram nodes, named after the dot shapes they stand for
+const (
+	diagramShapeBox           = "box"
+	diagramShapeComponent     = "component"
+	diagramShapeOctagon       = "octagon"
+	diagramShapeDoubleOctagon = "doubleoctagon"
+	diagramShapeNote          = "note"
+)
+
+// Diagram is the graph with the styling of the dot output, for rendering in other diagram languages (PlantUML, D2).
+// Like in the dot output, ClusterRoles bound by RoleBindings are drawn in the RoleBinding's namespace.
+type Diagram struct {
+	theme *Theme
+	root  *DiagramCluster
+	edges []*DiagramEdge
+}
+
+// DiagramCluster is a namespace (drawn dashed) or the legend
+type DiagramCluster struct {
+	id       string
+	label    string
+	dashed   bool
+	parent   *DiagramCluster
+	clusters map[string]*DiagramCluster
+	nodes    map[string]*DiagramNode
+}
+
+// DiagramNode is a node of the diagram. Like a dot node ID, its key identifies it within its cluster and the nested
+// clusters. Its id is assigned when writing the diagram.
+type DiagramNode struct {
+	key       string
+	id        string
+	seq       int
+	cluster   *DiagramCluster
+	rank      int
+	shape     string
+	lines     []DiagramLine
+	fill      string // not filled if empty
+	fontColor string // the theme's font color if empty
+	border    string // the theme's edge color if empty
+	dashed    bool
+	dotted    bool
+	bold      bool // drawn with a thicker border
+	tooltip   string
+	url       string
+}
+
+// DiagramLine is a line of a node label
+type DiagramLine struct {
+	text  string
+	bold  bool
+	faded bool
+}
+
+// DiagramEdge links two nodes. Back edges are drawn with the arrow pointing at the first node (like dot's dir=back).
+type DiagramEdge struct {
+	from, to *DiagramNode
+	back     bool
+	label    string
+	faded    bool
+}
+
+func newDiagram(t *Theme) *Diagram {
+	return &Diagram{theme: t, root: newDiagramCluster(nil, "", false)}
+}
+
+// genDiagram builds the diagram of the full view from the graph model
+func (r *Rback) genDiagram() *Diagram {
+	t := r.config.theme
+	d := newDiagram(t)
+	r.addDiagramLegend(d)
+
+	m := r.graphModel()
+	incoming := map[string][]*GraphNode{}
+	for _, edge := range m.Edges {
+		incoming[edge.To] = append(incoming[edge.To], m.nodes[edge.From])
+	}
+	// ClusterRoles that are drawn outside of namespaces (in addition to the copies in the namespaces of RoleBindings)
+	clusterWide := map[string]bool{}
+	roles := r.selectedRoles()
+	if r.depthLimited() {
+		roles = append(roles, r.neighborhood().roles...)
+	}
+	for _, role := range roles {
+		clusterWide[roleRef(role).String()] = true
+	}
+
+	nodes := map[string]*DiagramNode{}
+	for _, node := range m.Nodes {
+		switch node.Type {
+		case nodeTypeWorkload:
+			nodes[node.ID] = newWorkloadDiagramNode(d.group(node.Namespace, node), t, node.Kind, node.Namespace, node.Name, !node.NoToken, false)
+			applyDiagramColor(nodes[node.ID], node.Color, r.colorFontColor())
+			linkDiagramNode(nodes[node.ID], node)
+		case nodeTypeSubject:
+			nodes[node.ID] = newSubjectDiagramNode(d.group(node.Namespace, node), t, node.Kind, node.Name, !node.Missing, node.Focused)
+			applyDiagramColor(nodes[node.ID], node.Color, r.colorFontColor())
+			linkDiagramNode(nodes[node.ID], node)
+		case nodeTypeBinding:
+			nodes[node.ID] = newBindingDiagramNode(d.group(node.Namespace, node), t, node.Kind, node.Name, node.Focused)
+			applyDiagramColor(nodes[node.ID], node.Color, r.colorFontColor())
+			linkDiagramNode(nodes[node.ID], node)
+		case nodeTypeRole:
+			boundClusterWide := len(incoming[node.ID]) == 0
+			for _, binding := range incoming[node.ID] {
+				boundClusterWide = boundClusterWide || binding.Kind == "ClusterRoleBinding"
+			}
+			if node.Namespace != "" || boundClusterWide || clusterWide[node.ID] {
+				nodes[node.ID] = r.addDiagramRole(d, "", node)
+			}
+		}
+	}
+
+	for _, edge := range m.Edges {
+		from, to := m.nodes[edge.From], m.nodes[edge.To]
+		switch from.Type {
+		case nodeTypeWorkload:
+			d.edge(nodes[from.ID], nodes[to.ID])
+		case nodeTypeSubject:
+			e := d.edge(nodes[from.ID], nodes[to.ID])
+			e.back = true
+			annotateDiagramEdge(e, edge.Hits)
+		case nodeTypeBinding:
+			roleNode := nodes[to.ID]
+			if to.Namespace == "" && from.Namespace != "" {
+				roleNode = r.addDiagramRole(d, from.Namespace, to)
+			}
+			annotateDiagramEdge(d.edge(nodes[from.ID], roleNode), edge.Hits)
+		}
+	}
+	return d
+}
+
+// addDiagramRole adds a role and its access rules to the namespace of the role or, for ClusterRoles bound by a
+// RoleBinding, to the namespace of the RoleBinding
+func (r *Rback) addDiagramRole(d *Diagram, bindingNamespace string, node *GraphNode) *DiagramNode {
+	role := NamespacedName{node.Namespace, node.Name}
+	c := d.group(iff(node.Namespace == "", bindingNamespace, node.Namespace), node)
+	roleNode := newRoleDiagramNode(c, d.theme, bindingNamespace, role, !node.Missing, node.Focused)
+	applyDiagramColor(roleNode, node.Color, r.colorFontColor())
+	linkDiagramNode(roleNode, node)
+	if r.config.showRules {
+		highlight := r.isFocused(kindRule, role.namespace, role.name)
+		if lines := r.diagramRuleLines(role, highlight); len(lines) > 0 {
+			rulesNode := newRulesDiagramNode(c, d.theme, role, lines, highlight)
+			linkDiagramNode(rulesNode, node)
+			annotateDiagramEdge(d.edge(roleNode, rulesNode), r.modelHits(r.roleHits(role)))
+		}
+	}
+	return roleNode
+}
+
+// diagramRuleLines returns the lines of a rules node, like newRulesNode does for the dot output
+func (r *Rback) diagramRuleLines(role NamespacedName, highlight bool) []DiagramLine {
+	lines := []DiagramLine{}
+	for i, rule := range r.renderedRules(r.permissions.Roles[role.namespace][role.name]) {
+		if r.config.resourceKind == kindRule && highlight && r.config.whoCan.matches(rule) {
+			lines = append(lines, DiagramLine{text: rule.toHumanReadableString(), bold: true})
+		} else if r.config.whoCan.showMatchedOnly {
+			if len(lines) == 0 || lines[len(lines)-1].text != "..." {
+				lines = append(lines, DiagramLine{text: "..."})
+			}
+		} else if r.auditLog == nil {
+			lines = append(lines, DiagramLine{text: rule.toHumanReadableString()})
+		} else if hits := r.ruleHits(role, i); hits > 0 {
+			lines = append(lines, DiagramLine{text: fmt.Sprintf("%s  [%d]", rule.toHumanReadableString(), hits)})
+		} else {
+			lines = append(lines, DiagramLine{text: rule.toHumanReadableString(), faded: true})
+		}
+	}
+	return lines
+}
+
+// addDiagramLegend adds the same legend as renderLegend does to the dot output
+func (r *Rback) addDiagramLegend(d *Diagram) {
+	if !r.config.showLegend {
+		return
+	}
+	t := d.theme
+	legend := d.root.cluster("LEGEND", false)
+	namespace := legend.cluster("Namespace", true)
+
+	sa := newSubjectDiagramNode(namespace, t, "Kind", "Subject", true, false)
+	missingSa := newSubjectDiagramNode(namespace, t, "Kind", "Missing Subject", false, false)
+	if r.config.showWorkloads && r.hasWorkloads() {
+		d.edge(newWorkloadDiagramNode(namespace, t, "Kind", "ns", "Workload", true, false), sa)
+	}
+
+	role := newRoleDiagramNode(namespace, t, "ns", NamespacedName{"ns", "Role"}, true, false)
+	clusterRoleBoundLocally := newRoleDiagramNode(namespace, t, "ns", NamespacedName{"", "ClusterRole"}, true, false)
+	clusterRole := newRoleDiagramNode(legend, t, "", NamespacedName{"", "ClusterRole"}, true, false)
+
+	roleBinding := newBindingDiagramNode(namespace, t, "RoleBinding", "RoleBinding", false)
+	d.edge(sa, roleBinding).back = true
+	d.edge(missingSa, roleBinding).back = true
+	d.edge(roleBinding, role)
+
+	roleBinding2 := newBindingDiagramNode(namespace, t, "RoleBinding", "RoleBinding-to-ClusterRole", false)
+	roleBinding2.lines = []DiagramLine{{text: "RoleBinding"}}
+	d.edge(sa, roleBinding2).back = true
+	d.edge(roleBinding2, clusterRoleBoundLocally)
+
+	clusterRoleBinding := newBindingDiagramNode(legend, t, "ClusterRoleBinding", "ClusterRoleBinding", false)
+	d.edge(sa, clusterRoleBinding).back = true
+	d.edge(clusterRoleBinding, clusterRole)
+
+	if r.config.showRules {
+		namespaced := []DiagramLine{{text: "Namespace-scoped"}, {text: "access rules"}}
+		d.edge(role, newRulesDiagramNode(namespace, t, NamespacedName{"ns", "Role"}, namespaced, false))
+		d.edge(clusterRoleBoundLocally, newRulesDiagramNode(namespace, t, NamespacedName{"ns", "ClusterRole"}, namespaced, false))
+		clusterScoped := []DiagramLine{{text: "Cluster-scoped"}, {text: "access rules"}}
+		d.edge(clusterRole, newRulesDiagramNode(legend, t, NamespacedName{"", "ClusterRole"}, clusterScoped, false))
+	}
+
+	if r.config.colorBy == colorByRisk {
+		for _, level := range []struct {
+			label string
+			score int
+		}{{"Low risk", 0}, {"Medium risk", mediumRiskScore}, {"High risk", highRiskScore}} {
+			node := legend.add(&DiagramNode{key: "risk-" + level.label, rank: diagramRankSubject, shape: diagramShapeBox,
+				lines: []DiagramLine{{text: level.label}, {text: fmt.Sprintf("(score >= %d)", level.score)}}})
+			applyDiagramColor(node, t.riskColor(level.score), t.Risk.FontColor)
+		}
+	} else if key, ok := parseMetadataKey(r.config.colorBy); ok {
+		for _, value := range r.metadataValues(key) {
+			node := legend.add(&DiagramNode{key: "meta-" + value, rank: diagramRankSubject, shape: diagramShapeBox,
+				lines: []DiagramLine{{text: fmt.Sprintf("%s=%s", key, value)}}})
+			applyDiagramColor(node, r.metadataColor(key, value), t.Palette.FontColor)
+		}
+	}
+}
+
+func newSubjectDiagramNode(c *DiagramCluster, t *Theme, kind, name string, exists, highlight bool) *DiagramNode {
+	return c.add(styledDiagramNode(&DiagramNode{
+		key:   kind + "-" + name,
+		rank:  diagramRankSubject,
+		lines: diagramLabel(highlight, name, "("+kind+")"),
+	}, t.Nodes.Subject, t.nodeStyle(t.Nodes.Subject, exists, highlight)))
+}
+
+func newWorkloadDiagramNode(c *DiagramCluster, t *Theme, kind, namespace, name string, mountsToken, highlight bool) *DiagramNode {
+	lines := []string{name, "(" + kind + ")"}
+	style := t.nodeStyle(t.Nodes.Workload, true, highlight)
+	if !mountsToken {
+		lines = append(lines, "no token mounted")
+		style = style.withStyle("dashed")
+	}
+	return c.add(styledDiagramNode(&DiagramNode{
+		key:   "wl-" + kind + "-" + namespace + "/" + name,
+		rank:  diagramRankWorkload,
+		lines: diagramLabel(highlight, lines...),
+	}, t.Nodes.Workload, style))
+}
+
+func newBindingDiagramNode(c *DiagramCluster, t *Theme, kind, name string, highlight bool) *DiagramNode {
+	base := t.Nodes.RoleBinding
+	if kind == "ClusterRoleBinding" {
+		base = t.Nodes.ClusterRoleBinding
+	}
+	return c.add(styledDiagramNode(&DiagramNode{
+		key:   iff(kind == "ClusterRoleBinding", "crb-", "rb-") + name,
+		rank:  diagramRankBinding,
+		lines: diagramLabel(highlight, name),
+	}, base, t.nodeStyle(base, true, highlight)))
+}
+
+func newRoleDiagramNode(c *DiagramCluster, t *Theme, bindingNamespace string, role NamespacedName, exists, highlight bool) *DiagramNode {
+	key, base := "r-"+role.namespace+"/"+role.name, t.Nodes.Role
+	if role.namespace == "" {
+		key, base = "cr-"+bindingNamespace+"/"+role.name, t.Nodes.ClusterRole
+	}
+	style := t.nodeStyle(base, exists, highlight)
+	if exists && role.namespace == "" && bindingNamespace != "" {
+		style = style.withStyle("dashed")
+	}
+	return c.add(styledDiagramNode(&DiagramNode{
+		key:   key,
+		rank:  diagramRankRole,
+		lines: diagramLabel(highlight, role.name),
+	}, base, style))
+}
+
+func newRulesDiagramNode(c *DiagramCluster, t *Theme, role NamespacedName, lines []DiagramLine, highlight bool) *DiagramNode {
+	return c.add(styledDiagramNode(&DiagramNode{
+		key:   "rules-" + role.namespace + "/" + role.name,
+		rank:  diagramRankRules,
+		lines: lines,
+	}, t.Nodes.Rules, t.nodeStyle(t.Nodes.Rules, true, highlight)))
+}
+
+// styledDiagramNode sets the shape and colors of a node from its theme style. The node is drawn bold if the style's
+// pen width is larger than the one of its kind (i.e. it's highlighted or missing).
+func styledDiagramNode(node *DiagramNode, base, style ThemeStyle) *DiagramNode {
+	node.shape = style.Shape
+	if style.hasStyle("filled") {
+		node.fill = style.FillColor
+	}
+	node.fontColor = style.FontColor
+	node.border = style.Color
+	node.dashed = style.hasStyle("dashed")
+	node.dotted = style.hasStyle("dotted")
+	node.bold = penWidthOf(style.PenWidth) > penWidthOf(base.PenWidth)
+	return node
+}
+
+// diagramLabel returns the lines of a label, all bold if highlighted
+func diagramLabel(highlight bool, texts ...string) []DiagramLine {
+	lines := []DiagramLine{}
+	for _, text := range texts {
+		lines = append(lines, DiagramLine{text: text, bold: highlight})
+	}
+	return lines
+}
+
+// applyDiagramColor overrides the fill color of a node (e.g. with the color of its risk score)
+func applyDiagramColor(node *DiagramNode, color, fontColor string) {
+	if color != "" {
+		node.fill, node.fontColor = color, fontColor
+	}
+}
+
+// linkDiagramNode sets the tooltip and URL of a node, like applyLink does for the dot output
+func linkDiagramNode(diagramNode *DiagramNode, node *GraphNode) {
+	diagramNode.tooltip, diagramNode.url = node.Tooltip, node.URL
+}
+
+// annotateDiagramEdge labels an edge with the number of logged requests that passed through it or, if there were
+// none, fades it (like annotateWithHits)
+func annotateDiagramEdge(edge *DiagramEdge, hits *int) {
+	if hits == nil {
+		return
+	}
+	if *hits > 0 {
+		edge.label = fmt.Sprintf("%d", *hits)
+	} else {
+		edge.faded = true
+	}
+}
+
+// group returns the cluster of the node's group within its namespace when grouping by a label or annotation, or the
+// namespace otherwise
+func (d *Diagram) group(ns string, node *GraphNode) *DiagramCluster {
+	if node.Group == "" {
+		return d.namespace(ns)
+	}
+	return d.namespace(ns).cluster(node.Group, false)
+}
+
+// namespace returns the dashed cluster of a namespace, or the diagram itself for cluster-wide resources
+func (d *Diagram) namespace(ns string) *DiagramCluster {
+	if ns == "" {
+		return d.root
+	}
+	return d.root.cluster(ns, true)
+}
+
+// cluster returns the nested cluster with the given label, creating it if it doesn't exist yet
+func (c *DiagramCluster) cluster(label string, dashed bool) *DiagramCluster {
+	if existing, found := c.clusters[label]; found {
+		return existing
+	}
+	c.clusters[label] = newDiagramCluster(c, label, dashed)
+	return c.clusters[label]
+}
+
+func newDiagramCluster(parent *DiagramCluster, label string, dashed bool) *DiagramCluster {
+	return &DiagramCluster{label: label, dashed: dashed, parent: parent, clusters: map[string]*DiagramCluster{}, nodes: map[string]*DiagramNode{}}
+}
+
+// add adds the node to the cluster, unless a node with the same key already exists in the cluster or the clusters it's
+// nested in (like dot.Graph.Node), and returns the node in the diagram
+func (c *DiagramCluster) add(node *DiagramNode) *DiagramNode {
+	for cluster := c; cluster != nil; cluster = cluster.parent {
+		if existing, found := cluster.nodes[node.key]; found {
+			return existing
+		}
+	}
+	node.cluster = c
+	c.nodes[node.key] = node
+	return node
+}
+
+// edge adds an edge between two nodes, unless it already exists, and returns the edge
+func (d *Diagram) edge(from, to *DiagramNode) *DiagramEdge {
+	for _, edge := range d.edges {
+		if edge.from == from && edge.to == to {
+			return edge
+		}
+	}
+	edge := &DiagramEdge{from: from, to: to}
+	d.edges = append(d.edges, edge)
+	return edge
+}
+
+// assignIDs gives the clusters and nodes short IDs in the order they're written, sorted by label and key, so that
+// the output is stable
+func (d *Diagram) assignIDs() {
+	clusters, nodes := 0, 0
+	var assign func(c *DiagramCluster)
+	assign = func(c *DiagramCluster) {
+		for _, node := range c.sortedNodes() {
+			nodes++
+			node.id, node.seq = fmt.Sprintf("n%d", nodes), nodes
+		}
+		for _, cluster := range c.sortedClusters() {
+			clusters++
+			cluster.id = fmt.Sprintf("c%d", clusters)
+			assign(cluster)
+		}
+	}
+	assign(d.root)
+	sort.Slice(d.edges, func(i, j int) bool {
+		if d.edges[i].from != d.edges[j].from {
+			return d.edges[i].from.seq < d.edges[j].from.seq
+		}
+		return d.edges[i].to.seq < d.edges[j].to.seq
+	})
+}
+
+func (c *DiagramCluster) sortedClusters() []*DiagramCluster {
+	clusters := []*DiagramCluster{}
+	for _, cluster := range c.clusters {
+		clusters = append(clusters, cluster)
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].label < clusters[j].label })
+	return clusters
+}
+
+func (c *DiagramCluster) sortedNodes() []*DiagramNode {
+	nodes := []*DiagramNode{}
+	for _, node := range c.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].key < nodes[j].key })
+	return nodes
+}
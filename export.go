@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// relationship types of the graph database exports
+const (
+	relationshipRunsAs    = "RUNS_AS"    // workload -> ServiceAccount
+	relationshipSubjectOf = "SUBJECT_OF" // subject -> binding
+	relationshipRoleRef   = "ROLE_REF"   // binding -> role
+	relationshipHasRule   = "HAS_RULE"   // role -> rule
+)
+
+// ExportNode is a node of the graph database exports. Its label is the kind (e.g. ClusterRole), "Workload" or "Rule".
+type ExportNode struct {
+	id         string
+	label      string
+	properties []ExportProperty
+}
+
+// ExportProperty is a property of an exported node or relationship. The value is a string, bool, int or []string.
+type ExportProperty struct {
+	key   string
+	value interface{}
+}
+
+// ExportRelationship links two exported nodes
+type ExportRelationship struct {
+	from, to   *ExportNode
+	kind       string
+	properties []ExportProperty
+}
+
+// exportGraph converts the graph model into nodes and relationships, adding each access rule of a role as a node of
+// its own
+func (r *Rback) exportGraph() ([]*ExportNode, []ExportRelationship) {
+	m := r.graphModel()
+	nodes := []*ExportNode{}
+	byID := map[string]*ExportNode{}
+	relationships := []ExportRelationship{}
+
+	for _, node := range m.Nodes {
+		label := node.Kind
+		properties := []ExportProperty{{"id", node.ID}}
+		if node.Type == nodeTypeWorkload {
+			label = "Workload"
+			properties = append(properties, ExportProperty{"kind", node.Kind})
+		}
+		properties = append(properties, ExportProperty{"name", node.Name})
+		if node.Namespace != "" {
+			properties = append(properties, ExportProperty{"namespace", node.Namespace})
+		}
+		properties = append(properties, ExportProperty{"missing", node.Missing}, ExportProperty{"focused", node.Focused})
+		if node.Type == nodeTypeWorkload {
+			properties = append(properties, ExportProperty{"tokenMounted", !node.NoToken})
+		}
+		if node.Risk != nil {
+			properties = append(properties, ExportProperty{"risk", *node.Risk})
+		}
+		properties = append(properties, metadataProperties("label.", node.Labels)...)
+		properties = append(properties, metadataProperties("annotation.", node.Annotations)...)
+		exportNode := &ExportNode{id: node.ID, label: label, properties: properties}
+		nodes = append(nodes, exportNode)
+		byID[node.ID] = exportNode
+
+		if node.Type == nodeTypeRole && r.config.showRules {
+			for i, rule := range r.permissions.Roles[node.Namespace][node.Name].rules {
+				ruleNode := &ExportNode{id: fmt.Sprintf("%s#%d", node.ID, i), label: "Rule", properties: []ExportProperty{
+					{"id", fmt.Sprintf("%s#%d", node.ID, i)},
+					{"verbs", rule.verbs},
+					{"resources", rule.resources},
+					{"apiGroups", rule.apiGroups},
+					{"resourceNames", rule.resourceNames},
+					{"nonResourceURLs", rule.nonResourceURLs},
+					{"rule", rule.toHumanReadableString()},
+				}}
+				nodes = append(nodes, ruleNode)
+				relationships = append(relationships, ExportRelationship{from: exportNode, to: ruleNode, kind: relationshipHasRule,
+					properties: []ExportProperty{{"index", i}}})
+			}
+		}
+	}
+
+	for _, edge := range m.Edges {
+		from, to := byID[edge.From], byID[edge.To]
+		kind := relationshipRoleRef
+		if from.label == "Workload" {
+			kind = relationshipRunsAs
+		} else if m.nodes[edge.From].Type == nodeTypeSubject {
+			kind = relationshipSubjectOf
+		}
+		relationship := ExportRelationship{from: from, to: to, kind: kind}
+		if edge.Hits != nil {
+			relationship.properties = []ExportProperty{{"hits", *edge.Hits}}
+		}
+		relationships = append(relationships, relationship)
+	}
+	return nodes, relationships
+}
+
+// metadataProperties flattens labels or annotations into properties (e.g. label.team), sorted by key
+func metadataProperties(prefix string, values map[string]string) []ExportProperty {
+	keys := []string{}
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	properties := []ExportProperty{}
+	for _, key := range keys {
+		properties = append(properties, ExportProperty{prefix + key, values[key]})
+	}
+	return properties
+}
+
+// writeCypher writes Cypher statements creating the graph in Neo4j or Memgraph. Nodes are merged by their id property,
+// so that the statements can be run repeatedly.
+func (r *Rback) writeCypher(w io.Writer) error {
+	nodes, relationships := r.exportGraph()
+	for _, node := range nodes {
+		assignments := []string{}
+		for _, property := range node.properties[1:] {
+			assignments = append(assignments, fmt.Sprintf("n.%s = %s", cypherKey(property.key), cypherValue(property.value)))
+		}
+		if _, err := fmt.Fprintf(w, "MERGE (n:%s {id: %s}) SET %s;\n", node.label, cypherValue(node.id), strings.Join(assignments, ", ")); err != nil {
+			return err
+		}
+	}
+	for _, relationship := range relationships {
+		properties := []string{}
+		for _, property := range relationship.properties {
+			properties = append(properties, fmt.Sprintf("%s: %s", property.key, cypherValue(property.value)))
+		}
+		_, err := fmt.Fprintf(w, "MATCH (a:%s {id: %s}), (b:%s {id: %s}) MERGE (a)-[:%s%s]->(b);\n",
+			relationship.from.label, cypherValue(relationship.from.id), relationship.to.label, cypherValue(relationship.to.id),
+			relationship.kind, iff(len(properties) == 0, "", " {"+strings.Join(properties, ", ")+"}"))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cypherKey quotes a property key with backticks unless it's a plain identifier (label and annotation keys contain dots,
+// slashes and dashes)
+func cypherKey(key string) string {
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return "`" + strings.Replace(key, "`", "``", -1) + "`"
+		}
+	}
+	return key
+}
+
+// cypherValue formats a property value as a Cypher literal (JSON string escapes are valid in Cypher, too)
+func cypherValue(value interface{}) string {
+	if list, ok := value.([]string); ok && list == nil {
+		value = []string{}
+	}
+	literal, _ := json.Marshal(value)
+	return string(literal)
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// writeGraphML writes the graph as GraphML (e.g. for Gephi or yEd). Lists (e.g. the verbs of a rule) are joined by commas.
+func (r *Rback) writeGraphML(w io.Writer) error {
+	nodes, relationships := r.exportGraph()
+	doc := graphML{XMLNS: "http://graphml.graphdrawing.org/xmlns", Graph: graphMLGraph{ID: "rback", EdgeDefault: "directed"}}
+	keys := map[string]bool{}
+	addKey := func(owner string, property ExportProperty) string {
+		id := owner + "-" + escapeGraphID(property.key) // label and annotation keys may contain characters invalid in IDs
+		if !keys[id] {
+			keys[id] = true
+			doc.Keys = append(doc.Keys, graphMLKey{ID: id, For: owner, AttrName: property.key, AttrType: graphMLType(property.value)})
+		}
+		return id
+	}
+
+	for _, node := range nodes {
+		graphNode := graphMLNode{ID: node.id}
+		for _, property := range append([]ExportProperty{{"label", node.label}}, node.properties...) {
+			graphNode.Data = append(graphNode.Data, graphMLData{Key: addKey("node", property), Value: graphMLValue(property.value)})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphNode)
+	}
+	for _, relationship := range relationships {
+		edge := graphMLEdge{Source: relationship.from.id, Target: relationship.to.id}
+		for _, property := range append([]ExportProperty{{"type", relationship.kind}}, relationship.properties...) {
+			edge.Data = append(edge.Data, graphMLData{Key: addKey("edge", property), Value: graphMLValue(property.value)})
+		}
+		doc.Graph.Edges = append(doc.Graph.Edges, edge)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func graphMLType(value interface{}) string {
+	switch value.(type) {
+	case bool:
+		return "boolean"
+	case int:
+		return "int"
+	}
+	return "string"
+}
+
+func graphMLValue(value interface{}) string {
+	switch v := value.(type) {
+	case []string:
+		return strings.Join(v, ",")
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.Itoa(v)
+	}
+	return fmt.Sprint(value)
+}
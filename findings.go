@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+	severityNote    = "note"
+)
+
+// Finding is a single problem reported by one of rback's checks, always pointing at the offending object
+type Finding struct {
+	ruleID      string
+	description string
+	severity    string
+	message     string
+	object      KindNamespacedName
+}
+
+func sortFindings(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.ruleID != b.ruleID {
+			return a.ruleID < b.ruleID
+		}
+		if a.object.String() != b.object.String() {
+			return a.object.String() < b.object.String()
+		}
+		return a.message < b.message
+	})
+}
+
+func printFindings(w io.Writer, findings []Finding, sources map[KindNamespacedName]SourcePosition) {
+	for _, f := range findings {
+		fmt.Fprintf(w, "%-7s [%s] %v: %s", f.severity, f.ruleID, f.object, f.message)
+		if pos, found := sources[f.object]; found {
+			fmt.Fprintf(w, " (%v)", pos)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "%d finding(s)\n", len(findings))
+}
+
+func hasErrors(findings []Finding) bool {
+	for _, f := range findings {
+		if f.severity == severityError {
+			return true
+		}
+	}
+	return false
+}
+
+func bindingRef(binding Binding) KindNamespacedName {
+	return KindNamespacedName{iff(binding.namespace == "", "ClusterRoleBinding", "RoleBinding"), binding.NamespacedName}
+}
+
+func roleRef(role NamespacedName) KindNamespacedName {
+	return KindNamespacedName{iff(role.namespace == "", "ClusterRole", "Role"), role}
+}
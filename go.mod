@@ -1,5 +1,8 @@
 module github.com/mhausenblas/rback
 
-go 1.12
+go 1.14
 
-require github.com/emicklei/dot v0.10.0
+require (
+	github.com/emicklei/dot v0.10.0
+	gopkg.in/yaml.v2 v2.2.8
+)
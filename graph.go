@@ -7,83 +7,111 @@ import (
 	"github.com/emicklei/dot"
 )
 
-func newGraph() *dot.Graph {
+func newGraph(t *Theme) *dot.Graph {
 	g := dot.NewGraph(dot.Directed)
 	g.Attr("newrank", "true") // global rank instead of per-subgraph (ensures access rules are always in the same place (at bottom))
+	setAttr(g.AttributesMap, "rankdir", t.RankDir)
+	setAttr(g.AttributesMap, "bgcolor", t.Background)
+	setAttr(g.AttributesMap, "fontname", t.FontName)
+	setAttr(g.AttributesMap, "fontcolor", t.FontColor)
 	return g
 }
 
-func newNamespaceSubgraph(g *dot.Graph, ns string) *dot.Graph {
+func newNamespaceSubgraph(g *dot.Graph, t *Theme, ns string) *dot.Graph {
 	if ns == "" {
 		return g
 	}
 	gns := g.Subgraph(ns, dot.ClusterOption{})
-	gns.Attr("style", "dashed")
+	setAttr(gns.AttributesMap, "style", t.Namespace.Style)
+	setAttr(gns.AttributesMap, "color", t.Namespace.Color)
+	setAttr(gns.AttributesMap, "fontcolor", t.Namespace.FontColor)
+	setAttr(gns.AttributesMap, "penwidth", t.Namespace.PenWidth)
 	return gns
 }
 
-func newSubjectNode0(g *dot.Graph, kind, name string, exists, highlight bool) dot.Node {
-	return g.Node(kind+"-"+name).
-		Box().
-		Attr("label", formatLabel(fmt.Sprintf("%s\n(%s)", name, kind), highlight)).
-		Attr("style", iff(exists, "filled", "dotted")).
-		Attr("color", iff(exists, "black", "red")).
-		Attr("penwidth", iff(highlight || !exists, "2.0", "1.0")).
-		Attr("fillcolor", "#2f6de1").
-		Attr("fontcolor", iff(exists, "#f0f0f0", "#030303"))
-}
-
-func newRoleBindingNode(g *dot.Graph, name string, highlight bool) dot.Node {
-	return g.Node("rb-"+name).
-		Attr("label", formatLabel(name, highlight)).
-		Attr("shape", "octagon").
-		Attr("style", "filled").
-		Attr("penwidth", iff(highlight, "2.0", "1.0")).
-		Attr("fillcolor", "#ffcc00").
-		Attr("fontcolor", "#030303")
-}
-
-func newClusterRoleBindingNode(g *dot.Graph, name string, highlight bool) dot.Node {
-	return g.Node("crb-"+name).
-		Attr("label", formatLabel(name, highlight)).
-		Attr("shape", "doubleoctagon").
-		Attr("style", "filled").
-		Attr("penwidth", iff(highlight, "2.0", "1.0")).
-		Attr("fillcolor", "#ffcc00").
-		Attr("fontcolor", "#030303")
-}
-
-func newRoleNode(g *dot.Graph, namespace, name string, exists, highlight bool) dot.Node {
-	node := g.Node("r-"+namespace+"/"+name).
-		Attr("label", formatLabel(name, highlight)).
-		Attr("shape", "octagon").
-		Attr("style", iff(exists, "filled", "dotted")).
-		Attr("color", iff(exists, "black", "red")).
-		Attr("penwidth", iff(highlight || !exists, "2.0", "1.0")).
-		Attr("fillcolor", "#ff9900").
-		Attr("fontcolor", "#030303")
+// newGroupSubgraph returns the cluster of the nodes with the same label or annotation value within a namespace. Its
+// ID is derived from the namespace and label, as the IDs generated by dot are only unique within the parent graph.
+func newGroupSubgraph(g *dot.Graph, t *Theme, namespace, label string) *dot.Graph {
+	group := g.Subgraph(label, dot.ClusterOption{})
+	group.ID("cluster_group_" + escapeGraphID(namespace) + "__" + escapeGraphID(label))
+	setAttr(group.AttributesMap, "style", t.Group.Style)
+	setAttr(group.AttributesMap, "color", t.Group.Color)
+	setAttr(group.AttributesMap, "fontcolor", t.Group.FontColor)
+	setAttr(group.AttributesMap, "penwidth", t.Group.PenWidth)
+	return group
+}
+
+// escapeGraphID returns s with all characters other than letters and digits escaped as _XX (their hex code), so that
+// it can be used within an unquoted dot ID
+func escapeGraphID(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "_%02x", c)
+		}
+	}
+	return b.String()
+}
+
+func newSubjectNode0(g *dot.Graph, t *Theme, kind, name string, exists, highlight bool) dot.Node {
+	return t.styleNode(g.Node(kind+"-"+name), t.nodeStyle(t.Nodes.Subject, exists, highlight)).
+		Attr("label", formatLabel(fmt.Sprintf("%s\n(%s)", name, kind), highlight))
+}
+
+func newWorkloadNode0(g *dot.Graph, t *Theme, kind, namespace, name string, mountsToken, highlight bool) dot.Node {
+	label := fmt.Sprintf("%s\n(%s)", name, kind)
+	if !mountsToken {
+		label += "\nno token mounted"
+	}
+	style := t.Nodes.Workload
+	if !mountsToken {
+		style = style.withStyle("dashed")
+	}
+	node := t.styleNode(g.Node("wl-"+kind+"-"+namespace+"/"+name), t.nodeStyle(style, true, highlight)).
+		Attr("label", formatLabel(label, highlight))
+	g.Root().AddToSameRank("Workloads", node)
+	return node
+}
+
+func newRoleBindingNode(g *dot.Graph, t *Theme, name string, highlight bool) dot.Node {
+	return t.styleNode(g.Node("rb-"+name), t.nodeStyle(t.Nodes.RoleBinding, true, highlight)).
+		Attr("label", formatLabel(name, highlight))
+}
+
+func newClusterRoleBindingNode(g *dot.Graph, t *Theme, name string, highlight bool) dot.Node {
+	return t.styleNode(g.Node("crb-"+name), t.nodeStyle(t.Nodes.ClusterRoleBinding, true, highlight)).
+		Attr("label", formatLabel(name, highlight))
+}
+
+func newRoleNode(g *dot.Graph, t *Theme, namespace, name string, exists, highlight bool) dot.Node {
+	node := t.styleNode(g.Node("r-"+namespace+"/"+name), t.nodeStyle(t.Nodes.Role, exists, highlight)).
+		Attr("label", formatLabel(name, highlight))
 	g.Root().AddToSameRank("Roles", node)
 	return node
 }
 
-func newClusterRoleNode(g *dot.Graph, bindingNamespace, roleName string, exists, highlight bool) dot.Node {
-	node := g.Node("cr-"+bindingNamespace+"/"+roleName).
-		Attr("label", formatLabel(roleName, highlight)).
-		Attr("shape", "doubleoctagon").
-		Attr("style", iff(exists, iff(bindingNamespace == "", "filled", "filled,dashed"), "dotted")).
-		Attr("color", iff(exists, "black", "red")).
-		Attr("penwidth", iff(highlight || !exists, "2.0", "1.0")).
-		Attr("fillcolor", "#ff9900").
-		Attr("fontcolor", "#030303")
+func newClusterRoleNode(g *dot.Graph, t *Theme, bindingNamespace, roleName string, exists, highlight bool) dot.Node {
+	style := t.Nodes.ClusterRole
+	if bindingNamespace != "" {
+		style = style.withStyle("dashed") // bound by a (namespaced!) RoleBinding
+	}
+	node := t.styleNode(g.Node("cr-"+bindingNamespace+"/"+roleName), t.nodeStyle(style, exists, highlight)).
+		Attr("label", formatLabel(roleName, highlight))
 	g.Root().AddToSameRank("Roles", node)
 	return node
 }
 
-func newRulesNode0(g *dot.Graph, namespace, roleName, rulesHTML string, highlight bool) dot.Node {
-	return g.Node("rules-"+namespace+"/"+roleName).
-		Attr("label", dot.HTML(rulesHTML)).
-		Attr("shape", "note").
-		Attr("penwidth", iff(highlight, "2.0", "1.0"))
+func newRulesNode0(g *dot.Graph, t *Theme, namespace, roleName, rulesHTML string, highlight bool) dot.Node {
+	return t.styleNode(g.Node("rules-"+namespace+"/"+roleName), t.nodeStyle(t.Nodes.Rules, true, highlight)).
+		Attr("label", dot.HTML(rulesHTML))
+}
+
+func newPermissionsNode0(g *dot.Graph, kind, namespace, name, tableHTML string) dot.Node {
+	return g.Node("perms-"+kind+"-"+namespace+"/"+name).
+		Attr("label", dot.HTML(tableHTML)).
+		Attr("shape", "plain")
 }
 
 func regularLine(str string) string {
@@ -94,6 +122,10 @@ func boldLine(str string) string {
 	return "<b>" + escapeHTML(str) + "</b>" + `<br align="left"/>`
 }
 
+func fadedLine(t *Theme, str string) string {
+	return `<font color="` + t.FadedText + `">` + escapeHTML(str) + "</font>" + `<br align="left"/>`
+}
+
 func formatLabel(label string, highlight bool) interface{} {
 	if highlight {
 		return dot.HTML("<b>" + escapeHTML(label) + "</b>")
@@ -110,23 +142,31 @@ func escapeHTML(str string) string {
 	return str
 }
 
-func newSubjectToBindingEdge(subjectNode dot.Node, bindingNode dot.Node) dot.Edge {
-	return edge(subjectNode, bindingNode).Attr("dir", "back")
+func newWorkloadToSubjectEdge(t *Theme, workloadNode dot.Node, subjectNode dot.Node) dot.Edge {
+	return edge(t, workloadNode, subjectNode)
+}
+
+func newSubjectToBindingEdge(t *Theme, subjectNode dot.Node, bindingNode dot.Node) dot.Edge {
+	return edge(t, subjectNode, bindingNode).Attr("dir", "back")
+}
+
+func newBindingToRoleEdge(t *Theme, bindingNode dot.Node, roleNode dot.Node) dot.Edge {
+	return edge(t, bindingNode, roleNode)
 }
 
-func newBindingToRoleEdge(bindingNode dot.Node, roleNode dot.Node) dot.Edge {
-	return edge(bindingNode, roleNode)
+func newSubjectToPermissionsEdge(t *Theme, subjectNode dot.Node, permissionsNode dot.Node) dot.Edge {
+	return edge(t, subjectNode, permissionsNode)
 }
 
-func newRoleToRulesEdge(roleNode dot.Node, rulesNode dot.Node) dot.Edge {
-	return edge(roleNode, rulesNode)
+func newRoleToRulesEdge(t *Theme, roleNode dot.Node, rulesNode dot.Node) dot.Edge {
+	return edge(t, roleNode, rulesNode)
 }
 
 // edge creates a new edge between two nodes, but only if the edge doesn't exist yet
-func edge(from dot.Node, to dot.Node) dot.Edge {
+func edge(t *Theme, from dot.Node, to dot.Node) dot.Edge {
 	existingEdges := from.EdgesTo(to)
 	if len(existingEdges) == 0 {
-		return from.Edge(to)
+		return t.styleEdge(from.Edge(to), t.Edge)
 	} else {
 		return existingEdges[0]
 	}
@@ -0,0 +1,497 @@
+package main
+
+import (
+	"html/template"
+	"io"
+)
+
+// htmlReport is the data of the HTML report template
+type htmlReport struct {
+	Model      *GraphModel
+	ShowLegend bool
+	Live       bool
+	Colors     htmlColors
+}
+
+// htmlColors are the theme's colors used by the HTML report, whose node shapes are its own
+type htmlColors struct {
+	Fill        map[string]string `json:"fill"`
+	Text        map[string]string `json:"text"`
+	Border      map[string]string `json:"border"`
+	Missing     string            `json:"missing"`
+	MissingFill string            `json:"missingFill"`
+	MissingText string            `json:"missingText"`
+	Edge        string            `json:"edge"`
+	UnusedEdge  string            `json:"unusedEdge"`
+	Background  string            `json:"background"`
+	ColorText   string            `json:"colorText"` // text of nodes colored by --color-by
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(htmlReportSource))
+
+// writeHTML writes a self-contained HTML report, which renders the graph in the browser and lets users search for and
+// focus on subjects, bindings and roles. It doesn't load anything from the network.
+func (r *Rback) writeHTML(w io.Writer) error {
+	return r.writeLiveHTML(w, false)
+}
+
+// writeLiveHTML writes the HTML report. A live report is served by rback serve and reloads itself when the served
+// resources change.
+func (r *Rback) writeLiveHTML(w io.Writer, live bool) error {
+	return htmlReportTemplate.Execute(w, htmlReport{Model: r.graphModel(), ShowLegend: r.config.showLegend, Live: live, Colors: r.newHTMLColors()})
+}
+
+func (r *Rback) newHTMLColors() htmlColors {
+	t := r.config.theme
+	styles := map[string]ThemeStyle{
+		nodeTypeWorkload: t.Nodes.Workload,
+		nodeTypeSubject:  t.Nodes.Subject,
+		nodeTypeBinding:  t.Nodes.RoleBinding,
+		nodeTypeRole:     t.Nodes.Role,
+	}
+	colors := htmlColors{
+		Fill:        map[string]string{},
+		Text:        map[string]string{},
+		Border:      map[string]string{},
+		Missing:     iff(t.Missing.Color == "", "red", t.Missing.Color),
+		MissingFill: iff(t.Missing.hasStyle("filled"), t.Missing.FillColor, iff(t.Background == "", "#ffffff", t.Background)),
+		MissingText: iff(t.Missing.FontColor == "", "#030303", t.Missing.FontColor),
+		Edge:        iff(t.Edge.Color == "", "#666", t.Edge.Color),
+		UnusedEdge:  iff(t.UnusedEdge.Color == "", "#c0c0c0", t.UnusedEdge.Color),
+		Background:  iff(t.Background == "", "#fafafa", t.Background),
+		ColorText:   r.colorFontColor(),
+	}
+	for nodeType, style := range styles {
+		colors.Fill[nodeType] = iff(style.hasStyle("filled"), style.FillColor, "#ffffff")
+		colors.Text[nodeType] = iff(style.FontColor == "", "#030303", style.FontColor)
+		colors.Border[nodeType] = iff(style.Color == "", "#222", style.Color)
+	}
+	return colors
+}
+
+const htmlReportSource = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>rback</title>
+<style>
+  html, body { margin: 0; height: 100%; font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; font-size: 13px; }
+  body { display: flex; }
+  #canvas { flex: 1; position: relative; overflow: hidden; background: {{.Colors.Background}}; }
+  #canvas svg { width: 100%; height: 100%; cursor: grab; }
+  #canvas svg.dragging { cursor: grabbing; }
+  #toolbar { position: absolute; top: 10px; left: 10px; display: flex; gap: 6px; }
+  #toolbar input { width: 260px; padding: 5px 8px; border: 1px solid #bbb; border-radius: 3px; }
+  #toolbar button { padding: 5px 10px; border: 1px solid #bbb; border-radius: 3px; background: #fff; cursor: pointer; }
+  #matches { position: absolute; top: 42px; left: 10px; width: 278px; max-height: 50%; overflow-y: auto; background: #fff;
+    border: 1px solid #bbb; border-radius: 3px; display: none; }
+  #matches div { padding: 4px 8px; cursor: pointer; }
+  #matches div:hover { background: #eef; }
+  #panel { width: 360px; overflow-y: auto; border-left: 1px solid #ccc; padding: 0 14px; background: #fff; }
+  #panel h2 { font-size: 15px; margin: 14px 0 2px; word-break: break-all; }
+  #panel h3 { font-size: 13px; margin: 14px 0 4px; color: #555; }
+  #panel ul { margin: 0; padding-left: 18px; }
+  #panel li { margin: 2px 0; word-break: break-all; }
+  #panel a { color: #1a4fb3; cursor: pointer; text-decoration: none; }
+  #panel a:hover { text-decoration: underline; }
+  #panel .kind { color: #777; }
+  #panel .note { color: #b00; }
+  #panel code { font-size: 12px; }
+  .node text { pointer-events: none; }
+  .node { cursor: pointer; }
+  .dimmed { opacity: 0.2; }
+  .legend-swatch { display: inline-block; width: 12px; height: 12px; border: 1px solid #333; margin-right: 6px; vertical-align: middle; }
+</style>
+</head>
+<body>
+<div id="canvas">
+  <svg id="svg"><g id="viewport"></g></svg>
+  <div id="toolbar">
+    <input id="search" type="search" placeholder="Search subjects, bindings and roles" autocomplete="off">
+    <button id="reset" title="Show all resources (Esc)">Show all</button>
+    <button id="fit" title="Fit the graph into the window">Fit</button>
+  </div>
+  <div id="matches"></div>
+</div>
+<div id="panel"></div>
+<script>
+var model = {{.Model}};
+var showLegend = {{.ShowLegend}};
+var live = {{.Live}};
+var colors = {{.Colors}};
+</script>
+<script>
+(function() {
+  var SVG_NS = "http://www.w3.org/2000/svg";
+  var NODE_WIDTH = 220, NODE_HEIGHT = 40, ROW_GAP = 14, COLUMN_GAP = 140;
+  var COLUMNS = { workload: 0, subject: 1, binding: 2, role: 3 };
+  var FILL = colors.fill, TEXT = colors.text, BORDER = colors.border;
+
+  var nodes = model.nodes || [], edges = model.edges || [];
+  var byId = {}, outgoing = {}, incoming = {};
+  nodes.forEach(function(n) { byId[n.id] = n; outgoing[n.id] = []; incoming[n.id] = []; });
+  edges.forEach(function(e) { outgoing[e.from].push(e); incoming[e.to].push(e); });
+
+  var svg = document.getElementById("svg"), viewport = document.getElementById("viewport");
+  var panel = document.getElementById("panel"), search = document.getElementById("search"), matches = document.getElementById("matches");
+  var view = { x: 20, y: 60, k: 1 };
+  var visible = null, selected = null, positions = {};
+
+  function el(name, attrs, parent) {
+    var e = document.createElementNS(SVG_NS, name);
+    for (var a in attrs) { e.setAttribute(a, attrs[a]); }
+    if (parent) { parent.appendChild(e); }
+    return e;
+  }
+
+  function html(tag, text, parent) {
+    var e = document.createElement(tag);
+    if (text !== undefined) { e.textContent = text; }
+    if (parent) { parent.appendChild(e); }
+    return e;
+  }
+
+  function clusterScoped(n) { return n.kind === "ClusterRole" || n.kind === "ClusterRoleBinding"; }
+  function isServiceAccount(n) { return n.kind === "ServiceAccount"; }
+  function sortKey(n) { return (n.namespace || "") + "/" + n.name + "/" + n.kind; }
+  function neighbors(id, dir) { return (dir === "in" ? incoming[id] : outgoing[id]).map(function(e) { return dir === "in" ? e.from : e.to; }); }
+
+  // focus mirrors rback's selection of bindings: a subject shows the bindings binding it, a role the bindings referring
+  // to it, and a binding itself. The bindings are shown with all their subjects and roles, and ServiceAccounts with
+  // their workloads.
+  function focus(id) {
+    var node = byId[id], bindings = [];
+    if (node.type === "binding") {
+      bindings = [id];
+    } else if (node.type === "subject") {
+      bindings = neighbors(id, "out");
+    } else if (node.type === "role") {
+      bindings = neighbors(id, "in");
+    } else if (node.type === "workload") {
+      neighbors(id, "out").forEach(function(sa) { bindings = bindings.concat(neighbors(sa, "out")); });
+    }
+    var set = {};
+    set[id] = true;
+    bindings.forEach(function(b) {
+      set[b] = true;
+      neighbors(b, "in").concat(neighbors(b, "out")).forEach(function(n) { set[n] = true; });
+    });
+    if (node.type === "workload") { neighbors(id, "out").forEach(function(sa) { set[sa] = true; }); }
+    Object.keys(set).forEach(function(n) {
+      if (isServiceAccount(byId[n])) { neighbors(n, "in").forEach(function(w) { set[w] = true; }); }
+    });
+    visible = set;
+    location.hash = encodeURIComponent(id);
+    select(id);
+    render();
+    fit();
+  }
+
+  function reset() {
+    visible = null;
+    history.replaceState(null, "", location.pathname + location.search);
+    render();
+    fit();
+  }
+
+  function isVisible(id) { return visible === null || visible[id]; }
+
+  // layout places the four node types in columns and orders each column by the average position of the connected
+  // nodes in the previous column to reduce edge crossings
+  function layout() {
+    var columns = [[], [], [], []];
+    nodes.forEach(function(n) { if (isVisible(n.id)) { columns[COLUMNS[n.type]].push(n); } });
+    var rank = {};
+    function place(column) {
+      column.forEach(function(n, i) { rank[n.id] = i; });
+    }
+    function barycenter(n, dir) {
+      var ranks = neighbors(n.id, dir).filter(function(m) { return rank[m] !== undefined; }).map(function(m) { return rank[m]; });
+      if (ranks.length === 0) { return Infinity; }
+      return ranks.reduce(function(a, b) { return a + b; }, 0) / ranks.length;
+    }
+    function byBarycenter(dir) {
+      return function(a, b) {
+        var ba = barycenter(a, dir), bb = barycenter(b, dir);
+        if (ba !== bb) { return ba < bb ? -1 : 1; }
+        return sortKey(a) < sortKey(b) ? -1 : sortKey(a) > sortKey(b) ? 1 : 0;
+      };
+    }
+    columns[1].sort(function(a, b) { return sortKey(a) < sortKey(b) ? -1 : sortKey(a) > sortKey(b) ? 1 : 0; });
+    place(columns[1]);
+    columns[2].sort(byBarycenter("in"));
+    place(columns[2]);
+    columns[3].sort(byBarycenter("in"));
+    place(columns[3]);
+    columns[0].sort(byBarycenter("out"));
+
+    positions = {};
+    columns.forEach(function(column, c) {
+      column.forEach(function(n, i) {
+        positions[n.id] = { x: c * (NODE_WIDTH + COLUMN_GAP), y: i * (NODE_HEIGHT + ROW_GAP) };
+      });
+    });
+  }
+
+  function render() {
+    layout();
+    while (viewport.firstChild) { viewport.removeChild(viewport.firstChild); }
+
+    edges.forEach(function(e) {
+      var from = positions[e.from], to = positions[e.to];
+      if (!from || !to) { return; }
+      var x1 = from.x + NODE_WIDTH, y1 = from.y + NODE_HEIGHT / 2, x2 = to.x, y2 = to.y + NODE_HEIGHT / 2, mx = (x1 + x2) / 2;
+      var unused = e.hits !== undefined && e.hits === 0;
+      el("path", {
+        d: "M" + x1 + "," + y1 + " C" + mx + "," + y1 + " " + mx + "," + y2 + " " + x2 + "," + y2,
+        fill: "none", stroke: unused ? colors.unusedEdge : colors.edge, "stroke-width": 1.2,
+        "stroke-dasharray": unused ? "5,4" : "none", "class": "edge", "data-from": e.from, "data-to": e.to
+      }, viewport);
+      if (e.hits) {
+        var label = el("text", { x: mx, y: (y1 + y2) / 2 - 3, "text-anchor": "middle", "font-size": 11, fill: colors.edge }, viewport);
+        label.textContent = e.hits;
+      }
+    });
+
+    nodes.forEach(function(n) {
+      var p = positions[n.id];
+      if (!p) { return; }
+      var g = el("g", { "class": "node", transform: "translate(" + p.x + "," + p.y + ")", "data-id": n.id }, viewport);
+      var dashed = n.missing || n.noToken;
+      el("rect", {
+        width: NODE_WIDTH, height: NODE_HEIGHT, rx: n.type === "subject" ? 2 : 10,
+        fill: n.missing ? colors.missingFill : (n.color || FILL[n.type]),
+        stroke: n.missing ? colors.missing : BORDER[n.type], "stroke-width": (n.focused || n.id === selected) ? 3 : 1,
+        "stroke-dasharray": dashed ? "4,3" : "none"
+      }, g);
+      if (clusterScoped(n)) {
+        el("rect", { x: 3, y: 3, width: NODE_WIDTH - 6, height: NODE_HEIGHT - 6, rx: 8, fill: "none", stroke: BORDER[n.type], "stroke-width": 0.8 }, g);
+      }
+      var textColor = n.missing ? colors.missingText : (n.color ? colors.colorText : TEXT[n.type]);
+      var name = el("text", { x: NODE_WIDTH / 2, y: 17, "text-anchor": "middle", fill: textColor, "font-weight": n.focused ? "bold" : "normal" }, g);
+      name.textContent = n.name.length > 32 ? n.name.substring(0, 31) + "…" : n.name;
+      var kind = el("text", { x: NODE_WIDTH / 2, y: 32, "text-anchor": "middle", fill: textColor, "font-size": 10 }, g);
+      kind.textContent = n.kind + (n.namespace ? " · " + n.namespace : "");
+      var title = el("title", {}, g);
+      title.textContent = n.tooltip || n.id;
+      g.addEventListener("click", function(event) { event.stopPropagation(); focus(n.id); });
+    });
+    highlightMatches();
+    applyView();
+  }
+
+  function applyView() {
+    viewport.setAttribute("transform", "translate(" + view.x + "," + view.y + ") scale(" + view.k + ")");
+  }
+
+  function fit() {
+    var ids = Object.keys(positions);
+    if (ids.length === 0) { return; }
+    var maxX = 0, maxY = 0;
+    ids.forEach(function(id) {
+      maxX = Math.max(maxX, positions[id].x + NODE_WIDTH);
+      maxY = Math.max(maxY, positions[id].y + NODE_HEIGHT);
+    });
+    var width = svg.clientWidth, height = svg.clientHeight - 60;
+    view.k = Math.min(1.5, (width - 40) / maxX, height / maxY);
+    view.x = (width - maxX * view.k) / 2;
+    view.y = 60;
+    applyView();
+  }
+
+  function link(id, parent) {
+    var a = html("a", id, parent);
+    a.addEventListener("click", function() { focus(id); });
+    return a;
+  }
+
+  function list(title, ids, parent) {
+    if (ids.length === 0) { return; }
+    html("h3", title, parent);
+    var ul = html("ul", undefined, parent);
+    ids.forEach(function(id) { link(id, html("li", undefined, ul)); });
+  }
+
+  function select(id) {
+    selected = id;
+    showPanel();
+  }
+
+  function showPanel() {
+    while (panel.firstChild) { panel.removeChild(panel.firstChild); }
+    if (selected === null) {
+      html("h2", "RBAC resources", panel);
+      html("p", "Click on a node or search for a subject, binding or role to focus on it.", panel);
+      var counts = {};
+      nodes.forEach(function(n) { counts[n.kind] = (counts[n.kind] || 0) + 1; });
+      var ul = html("ul", undefined, panel);
+      Object.keys(counts).sort().forEach(function(kind) { html("li", counts[kind] + " " + kind, ul); });
+      showLegendSection();
+      return;
+    }
+    var n = byId[selected];
+    html("h2", n.name, panel);
+    html("div", n.kind + (n.namespace ? " in namespace " + n.namespace : ""), panel).className = "kind";
+    if (n.missing) { html("p", "This " + n.kind + " doesn't exist.", panel).className = "note"; }
+    if (n.risk !== undefined) { html("p", "Risk score: " + n.risk, panel); }
+    if (n.noToken) { html("p", "Its Pods don't get the ServiceAccount token mounted.", panel); }
+    if (n.url) {
+      var link = html("a", n.url, html("p", undefined, panel));
+      link.href = n.url;
+      link.target = "_blank";
+      link.rel = "noopener";
+    }
+
+    if (n.type === "workload") {
+      list("Runs as", neighbors(n.id, "out"), panel);
+    } else if (n.type === "subject") {
+      var bindings = neighbors(n.id, "out");
+      if (bindings.length > 0) {
+        html("h3", "Bindings", panel);
+        var ul = html("ul", undefined, panel);
+        bindings.forEach(function(b) {
+          var li = html("li", undefined, ul);
+          link(b, li);
+          neighbors(b, "out").forEach(function(role) {
+            li.appendChild(document.createTextNode(" → "));
+            link(role, li);
+          });
+        });
+      }
+      list("Workloads", neighbors(n.id, "in"), panel);
+    } else if (n.type === "binding") {
+      list("Role", neighbors(n.id, "out"), panel);
+      list("Subjects", neighbors(n.id, "in"), panel);
+    } else if (n.type === "role") {
+      if (n.rules && n.rules.length > 0) {
+        html("h3", "Access rules", panel);
+        var rules = html("ul", undefined, panel);
+        n.rules.forEach(function(rule) { html("code", rule, html("li", undefined, rules)); });
+      }
+      list("Bound by", neighbors(n.id, "in"), panel);
+    }
+  }
+
+  function showLegendSection() {
+    if (!showLegend) { return; }
+    html("h3", "Legend", panel);
+    var ul = html("ul", undefined, panel);
+    [["Subject", FILL.subject], ["(Cluster)RoleBinding", FILL.binding], ["(Cluster)Role", FILL.role], ["Workload", FILL.workload]].forEach(function(entry) {
+      var li = html("li", undefined, ul);
+      html("span", undefined, li).className = "legend-swatch";
+      li.firstChild.style.background = entry[1];
+      li.appendChild(document.createTextNode(entry[0]));
+    });
+    html("li", "Double border: cluster-scoped", ul);
+    html("li", "Dashed red border: missing resource", ul);
+  }
+
+  function searchMatches() {
+    var query = search.value.trim().toLowerCase();
+    if (query === "") { return null; }
+    return nodes.filter(function(n) { return n.type !== "workload" && n.id.toLowerCase().indexOf(query) >= 0; });
+  }
+
+  function highlightMatches() {
+    var found = searchMatches(), ids = {};
+    (found || []).forEach(function(n) { ids[n.id] = true; });
+    Array.prototype.forEach.call(viewport.querySelectorAll(".node"), function(g) {
+      g.classList.toggle("dimmed", found !== null && !ids[g.getAttribute("data-id")]);
+    });
+    Array.prototype.forEach.call(viewport.querySelectorAll(".edge"), function(e) {
+      e.classList.toggle("dimmed", found !== null);
+    });
+  }
+
+  function showMatches() {
+    var found = searchMatches();
+    while (matches.firstChild) { matches.removeChild(matches.firstChild); }
+    matches.style.display = found && found.length > 0 ? "block" : "none";
+    (found || []).slice(0, 100).forEach(function(n) {
+      var item = html("div", n.id, matches);
+      item.addEventListener("click", function() { clearSearch(); focus(n.id); });
+    });
+    highlightMatches();
+  }
+
+  function clearSearch() {
+    search.value = "";
+    showMatches();
+  }
+
+  search.addEventListener("input", showMatches);
+  search.addEventListener("keydown", function(event) {
+    var found = searchMatches();
+    if (event.key === "Enter" && found && found.length > 0) {
+      clearSearch();
+      focus(found[0].id);
+    } else if (event.key === "Escape") {
+      clearSearch();
+    }
+  });
+  document.addEventListener("keydown", function(event) {
+    if (event.key === "Escape" && document.activeElement !== search) {
+      selected = null;
+      showPanel();
+      reset();
+    }
+  });
+  document.getElementById("reset").addEventListener("click", function() { selected = null; showPanel(); reset(); });
+  document.getElementById("fit").addEventListener("click", fit);
+
+  svg.addEventListener("wheel", function(event) {
+    event.preventDefault();
+    var rect = svg.getBoundingClientRect(), mx = event.clientX - rect.left, my = event.clientY - rect.top;
+    var k = Math.max(0.05, Math.min(5, view.k * Math.exp(-event.deltaY * 0.002)));
+    view.x = mx - (mx - view.x) * k / view.k;
+    view.y = my - (my - view.y) * k / view.k;
+    view.k = k;
+    applyView();
+  }, { passive: false });
+
+  var drag = null;
+  svg.addEventListener("mousedown", function(event) {
+    drag = { x: event.clientX, y: event.clientY, viewX: view.x, viewY: view.y };
+    svg.classList.add("dragging");
+  });
+  window.addEventListener("mousemove", function(event) {
+    if (drag === null) { return; }
+    view.x = drag.viewX + event.clientX - drag.x;
+    view.y = drag.viewY + event.clientY - drag.y;
+    applyView();
+  });
+  window.addEventListener("mouseup", function() {
+    drag = null;
+    svg.classList.remove("dragging");
+  });
+
+  // live reports poll the server and reload when the resources changed, keeping the focused node (stored in the URL hash)
+  function poll(generation) {
+    var request = new XMLHttpRequest();
+    request.onload = function() {
+      var current = request.responseText.trim();
+      if (generation !== null && current !== generation) {
+        location.reload();
+        return;
+      }
+      setTimeout(function() { poll(current); }, 5000);
+    };
+    request.onerror = function() { setTimeout(function() { poll(generation); }, 5000); };
+    request.open("GET", "generation");
+    request.send();
+  }
+
+  showPanel();
+  var focused = decodeURIComponent(location.hash.substring(1));
+  if (byId[focused]) {
+    focus(focused);
+  } else {
+    render();
+    fit();
+  }
+  if (live) { poll(null); }
+})();
+</script>
+</body>
+</html>
+`
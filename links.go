@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/emicklei/dot"
+)
+
+// maxTooltipValueLength truncates long annotation values (e.g. kubectl's last-applied-configuration) in tooltips
+const maxTooltipValueLength = 80
+
+// LinkTarget holds the fields that --link-template can refer to
+type LinkTarget struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+// objectURL returns the URL built from --link-template for an object, or "" if no template was given
+func (r *Rback) objectURL(object KindNamespacedName) string {
+	if r.config.linkTemplate == nil {
+		return ""
+	}
+	var url bytes.Buffer
+	if err := r.config.linkTemplate.Execute(&url, LinkTarget{object.kind, object.namespace, object.name}); err != nil {
+		return ""
+	}
+	return url.String()
+}
+
+// objectTooltip describes the full object: its creation timestamp, labels and annotations and, for roles, all its
+// access rules including their API groups
+func (r *Rback) objectTooltip(object KindNamespacedName) string {
+	lines := []string{object.String()}
+	if meta, found := r.permissions.Metadata[object]; found {
+		if meta.creationTimestamp != "" {
+			lines = append(lines, "created: "+meta.creationTimestamp)
+		}
+		lines = append(lines, tooltipSection("labels", meta.labels)...)
+		lines = append(lines, tooltipSection("annotations", meta.annotations)...)
+	}
+	if score, found := r.objectRiskScore(object); found {
+		lines = append(lines, fmt.Sprintf("risk score: %d", score))
+	}
+	if object.kind == "Role" || object.kind == "ClusterRole" {
+		if role, found := r.permissions.Roles[object.namespace][object.name]; found {
+			lines = append(lines, "rules:")
+			for _, rule := range role.rules {
+				lines = append(lines, "  "+rule.toFullString())
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func tooltipSection(title string, values map[string]string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	keys := []string{}
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	lines := []string{title + ":"}
+	for _, key := range keys {
+		value := values[key]
+		if runes := []rune(value); len(runes) > maxTooltipValueLength {
+			value = string(runes[:maxTooltipValueLength]) + "..."
+		}
+		lines = append(lines, fmt.Sprintf("  %s=%s", key, strings.Join(strings.Fields(value), " ")))
+	}
+	return lines
+}
+
+// toFullString renders all fields of a rule, unlike toHumanReadableString, which leaves out the core API group
+func (r *Rule) toFullString() string {
+	apiGroups := []string{}
+	for _, group := range r.apiGroups {
+		apiGroups = append(apiGroups, iff(group == "", `""`, group))
+	}
+	fields := []string{"verbs: " + strings.Join(r.verbs, ",")}
+	if len(r.apiGroups) > 0 {
+		fields = append(fields, "apiGroups: "+strings.Join(apiGroups, ","))
+	}
+	if len(r.resources) > 0 {
+		fields = append(fields, "resources: "+strings.Join(r.resources, ","))
+	}
+	if len(r.resourceNames) > 0 {
+		fields = append(fields, "resourceNames: "+strings.Join(r.resourceNames, ","))
+	}
+	if len(r.nonResourceURLs) > 0 {
+		fields = append(fields, "nonResourceURLs: "+strings.Join(r.nonResourceURLs, ","))
+	}
+	return strings.Join(fields, "; ")
+}
+
+// objectRiskScore returns the risk score of a subject or role if nodes are colored by risk
+func (r *Rback) objectRiskScore(object KindNamespacedName) (int, bool) {
+	if r.config.colorBy != colorByRisk {
+		return 0, false
+	}
+	if object.kind == "Role" || object.kind == "ClusterRole" {
+		score, found := r.risk().roles[object.NamespacedName]
+		return score, found
+	}
+	score, found := r.risk().subjects[object]
+	return score, found
+}
+
+// applyLink sets the tooltip and URL of a node
+func (r *Rback) applyLink(node dot.Node, object KindNamespacedName) {
+	node.Attr("tooltip", r.objectTooltip(object))
+	setAttr(node.AttributesMap, "URL", r.objectURL(object))
+}
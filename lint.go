@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+var lintChecks = []CheckInfo{
+	{"wildcard-verbs", "Access rules should list the verbs they need instead of using \"*\""},
+	{"wildcard-resources", "Access rules should list the resources they need instead of using \"*\""},
+	{"wildcard-apigroups", "Access rules should list the API groups they need instead of using \"*\""},
+	{"unused-serviceaccount", "ServiceAccounts that no Pod or controller runs as are candidates for deletion"},
+	{"default-serviceaccount-in-use", "Workloads should not run as the namespace's default ServiceAccount when it has bindings"},
+}
+
+// APIUsage is a single observed request, i.e. a verb performed on a resource in an API group ("" is the core group),
+// optionally in a namespace ("" for cluster-scoped resources or requests across all namespaces)
+type APIUsage struct {
+	verb      string
+	apiGroup  string
+	resource  string
+	namespace string
+}
+
+// lint returns the findings of all lint checks
+func (r *Rback) lint() []Finding {
+	findings := append(r.lintRoles(), r.lintServiceAccounts()...)
+	sortFindings(findings)
+	return findings
+}
+
+// lintRoles flags all access rules with wildcards in their verbs, resources or API groups
+func (r *Rback) lintRoles() []Finding {
+	findings := []Finding{}
+	for _, roles := range r.permissions.Roles {
+		for _, role := range roles {
+			if !r.namespaceSelected(role.namespace) {
+				continue
+			}
+			for _, rule := range role.rules {
+				for _, field := range rule.wildcardFields() {
+					findings = append(findings, Finding{
+						ruleID:      "wildcard-" + field,
+						description: lintCheckDescription("wildcard-" + field),
+						severity:    severityWarning,
+						message:     fmt.Sprintf("grants %q with wildcard %s", rule.toHumanReadableString(), field),
+						object:      roleRef(role.NamespacedName),
+					})
+				}
+			}
+		}
+	}
+	sortFindings(findings)
+	return findings
+}
+
+func lintCheckDescription(id string) string {
+	for _, check := range lintChecks {
+		if check.id == id {
+			return check.description
+		}
+	}
+	return ""
+}
+
+// wildcardFields returns the names of the fields in which the rule uses "*"
+func (r *Rule) wildcardFields() []string {
+	fields := []string{}
+	if contains(r.verbs, "*") {
+		fields = append(fields, "verbs")
+	}
+	if contains(r.resources, "*") {
+		fields = append(fields, "resources")
+	}
+	if contains(r.apiGroups, "*") {
+		fields = append(fields, "apigroups")
+	}
+	return fields
+}
+
+// grantedUsage returns the observed usage that is allowed by this rule
+func (r *Rule) grantedUsage(usage []APIUsage) []APIUsage {
+	granted := []APIUsage{}
+	for _, u := range usage {
+		if r.allows(u) {
+			granted = append(granted, u)
+		}
+	}
+	return granted
+}
+
+// minimalRules groups usage into as few rules as possible: resources in the same API group that are used with the same
+// verbs end up in a single rule
+func minimalRules(usage []APIUsage) []Rule {
+	verbsByResource := map[APIUsage][]string{} // keyed by apiGroup and resource only
+	for _, u := range usage {
+		key := APIUsage{apiGroup: u.apiGroup, resource: u.resource}
+		if !contains(verbsByResource[key], u.verb) {
+			verbsByResource[key] = append(verbsByResource[key], u.verb)
+		}
+	}
+
+	rulesByKey := map[string]*Rule{}
+	keys := []string{}
+	for resource, verbs := range verbsByResource {
+		sort.Strings(verbs)
+		key := resource.apiGroup + "|" + strings.Join(verbs, ",")
+		rule, found := rulesByKey[key]
+		if !found {
+			rule = &Rule{verbs: verbs, apiGroups: []string{resource.apiGroup}}
+			rulesByKey[key] = rule
+			keys = append(keys, key)
+		}
+		rule.resources = append(rule.resources, resource.resource)
+	}
+
+	sort.Strings(keys)
+	rules := []Rule{}
+	for _, key := range keys {
+		rule := rulesByKey[key]
+		sort.Strings(rule.resources)
+		rules = append(rules, *rule)
+	}
+	return rules
+}
+
+// suggestNarrowedRules returns, for each role with wildcard rules, the role's rules with the wildcard rules replaced
+// by the minimal rules needed for the observed usage they allow. The replacements keep the resourceNames of the
+// wildcard rules, so that they never grant more than the rules they replace.
+func (r *Rback) suggestNarrowedRules(usage []APIUsage) map[NamespacedName][]Rule {
+	suggestions := map[NamespacedName][]Rule{}
+	for _, roles := range r.permissions.Roles {
+		for _, role := range roles {
+			if !r.namespaceSelected(role.namespace) {
+				continue
+			}
+			kept := []Rule{}
+			granted := map[string][]APIUsage{} // keyed by the resourceNames of the wildcard rules
+			names := []string{}
+			changed := false
+			for _, rule := range role.rules {
+				if len(rule.wildcardFields()) > 0 && len(rule.nonResourceURLs) == 0 {
+					key := strings.Join(rule.resourceNames, ",")
+					if _, found := granted[key]; !found {
+						names = append(names, key)
+					}
+					granted[key] = append(granted[key], rule.grantedUsage(usage)...)
+					changed = true
+				} else {
+					kept = append(kept, rule)
+				}
+			}
+			if changed {
+				narrowed := []Rule{}
+				for _, key := range names {
+					for _, rule := range minimalRules(granted[key]) {
+						if key != "" {
+							rule.resourceNames = strings.Split(key, ",")
+						}
+						narrowed = append(narrowed, rule)
+					}
+				}
+				suggestions[role.NamespacedName] = append(narrowed, kept...)
+			}
+		}
+	}
+	return suggestions
+}
+
+// loadAPIUsage reads observed API usage from a file with one "VERB RESOURCE[.GROUP]" pair per line (e.g. "list deployments.apps")
+func loadAPIUsage(fileName string) ([]APIUsage, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	usage := []APIUsage{}
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Line %d: expected VERB RESOURCE[.GROUP], but found %q", lineNumber, line)
+		}
+		resource, apiGroup := fields[1], ""
+		if i := strings.Index(resource, "."); i >= 0 {
+			resource, apiGroup = resource[:i], resource[i+1:]
+		}
+		usage = append(usage, APIUsage{verb: fields[0], apiGroup: apiGroup, resource: resource})
+	}
+	return usage, scanner.Err()
+}
+
+// yamlRule is the YAML representation of an access rule, as used in (Cluster)Role manifests
+type yamlRule struct {
+	APIGroups       []string `yaml:"apiGroups,omitempty"`
+	Resources       []string `yaml:"resources,omitempty"`
+	ResourceNames   []string `yaml:"resourceNames,omitempty"`
+	NonResourceURLs []string `yaml:"nonResourceURLs,omitempty"`
+	Verbs           []string `yaml:"verbs"`
+}
+
+func toYAMLRules(rules []Rule) []yamlRule {
+	result := []yamlRule{}
+	for _, rule := range rules {
+		apiGroups := rule.apiGroups
+		if len(rule.resources) > 0 && len(apiGroups) == 0 {
+			apiGroups = []string{""}
+		}
+		result = append(result, yamlRule{
+			APIGroups:       apiGroups,
+			Resources:       rule.resources,
+			ResourceNames:   rule.resourceNames,
+			NonResourceURLs: rule.nonResourceURLs,
+			Verbs:           rule.verbs,
+		})
+	}
+	return result
+}
+
+// printSuggestedRules prints the narrowed rules of each role as a YAML snippet that can be pasted into the role's manifest
+func printSuggestedRules(w io.Writer, suggestions map[NamespacedName][]Rule) error {
+	roles := []NamespacedName{}
+	for role := range suggestions {
+		roles = append(roles, role)
+	}
+	sort.Slice(roles, func(i, j int) bool {
+		return roleRef(roles[i]).String() < roleRef(roles[j]).String()
+	})
+
+	for _, role := range roles {
+		out, err := yaml.Marshal(map[string][]yamlRule{"rules": toYAMLRules(suggestions[role])})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "\n# Suggested replacement for the rules of %v, based on observed API usage\n%s", roleRef(role), out)
+	}
+	return nil
+}
@@ -1,26 +1,57 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"strings"
+	"text/template"
+	"time"
 )
 
 type Rback struct {
-	config      Config
-	permissions Permissions
+	config            Config
+	permissions       Permissions
+	riskScores        *RiskScores
+	auditLog          *AuditLog
+	auditHitCounts    *AuditHits
+	focusNeighborhood *Neighborhood
+	metadataColors    map[string]string // the fill colors of the values of the label or annotation nodes are colored by
 }
 
 type Config struct {
+	command         string
 	inputFile       string
 	showRules       bool
+	compactRules    bool
+	showWorkloads   bool
 	showLegend      bool
 	namespaces      []string
 	ignoredPrefixes []string
 	resourceKind    string
 	resourceNames   []string
+	depth           int
+	view            string
+	output          string
+	matrixColumns   string
 	whoCan          WhoCan
+	policyFile      string
+	findingsFormat  string
+	colorBy         string
+	groupBy         string
+	selector        LabelSelector
+	linkTemplate    *template.Template
+	usageFile       string
+	auditLogFiles   []string
+	emitRoles       bool
+	auditGraph      bool
+	addr            string
+	reloadInterval  time.Duration
+	fromCluster     bool
+	watch           bool
+	theme           *Theme
 }
 
 type WhoCan struct {
@@ -30,43 +61,216 @@ type WhoCan struct {
 
 func main() {
 	config := parseConfigFromArgs()
+	if config.command == commandServe {
+		os.Exit(runServe(config))
+	}
 	rback := Rback{config: config}
 
-	var err error
-	reader := os.Stdin
-	if config.inputFile != "" {
-		reader, err = os.Open(config.inputFile)
+	input, err := readInput(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can't read RBAC resources: %v\n", err)
+		os.Exit(-1)
+	}
+
+	err = rback.parseRBAC(bytes.NewReader(input))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can't parse RBAC resources: %v\n", err)
+		os.Exit(-1)
+	}
+
+	if len(config.auditLogFiles) > 0 {
+		rback.auditLog, err = loadAuditLogs(config.auditLogFiles)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Can't open file %s: %v\n", config.inputFile, err)
+			fmt.Fprintf(os.Stderr, "Can't load audit logs: %v\n", err)
 			os.Exit(-1)
 		}
 	}
 
-	err = rback.parseRBAC(reader)
+	switch config.command {
+	case commandCheck:
+		os.Exit(rback.runCheck())
+	case commandCIS:
+		os.Exit(rback.runCIS())
+	case commandRisk:
+		rback.printRiskReport(os.Stdout)
+	case commandLint:
+		os.Exit(rback.runLint())
+	case commandAudit:
+		os.Exit(rback.runAudit())
+	case commandTUI:
+		os.Exit(rback.runTUI())
+	default:
+		exitCode := rback.runOutput()
+		if config.watch && exitCode == 0 {
+			exitCode = rback.runWatch(input)
+		}
+		os.Exit(exitCode)
+	}
+}
+
+// runWatch writes the output again whenever the input changes. It only returns (with the process exit code) if watching fails.
+func (r *Rback) runWatch(input []byte) int {
+	watcher, err := newWatcher(r.config, input)
+	if err == nil {
+		err = watcher.watch(func(changes []ObjectChange) {
+			r.applyChanges(changes)
+			r.runOutput()
+		})
+	}
+	fmt.Fprintf(os.Stderr, "Can't watch RBAC resources: %v\n", err)
+	return -1
+}
+
+// runOutput writes the graph (or a tabular projection of it) in the configured output format and returns the process exit code
+func (r *Rback) runOutput() int {
+	var err error
+	switch r.config.output {
+	case outputMatrixCSV:
+		err = r.accessMatrix().writeCSV(os.Stdout)
+	case outputMatrixMarkdown:
+		err = r.accessMatrix().writeMarkdown(os.Stdout)
+	case outputHTML:
+		err = r.writeHTML(os.Stdout)
+	case outputJSON:
+		err = r.writeJSON(os.Stdout)
+	case outputTree:
+		err = r.writeTree(os.Stdout, unicodeTreeGlyphs)
+	case outputTreeASCII:
+		err = r.writeTree(os.Stdout, asciiTreeGlyphs)
+	case outputCypher:
+		err = r.writeCypher(os.Stdout)
+	case outputGraphML:
+		err = r.writeGraphML(os.Stdout)
+	case outputPlantUML:
+		err = r.writePlantUML(os.Stdout)
+	case outputD2:
+		err = r.writeD2(os.Stdout)
+	case outputSVG:
+		err = r.writeSVG(os.Stdout)
+	default:
+		fmt.Println(r.genGraph().String())
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Can't parse RBAC resources from stdin: %v\n", err)
-		os.Exit(-1)
+		fmt.Fprintf(os.Stderr, "Can't write %s output: %v\n", r.config.output, err)
+		return -1
+	}
+	return 0
+}
+
+// runCheck evaluates the policy file against the parsed RBAC resources and returns the process exit code
+func (r *Rback) runCheck() int {
+	policy, err := loadPolicy(r.config.policyFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can't load policy from %s: %v\n", r.config.policyFile, err)
+		return -1
+	}
+	findings := r.checkPolicy(policy)
+	if err := r.writeFindings(os.Stdout, policy.checks(), findings); err != nil {
+		fmt.Fprintf(os.Stderr, "Can't write findings: %v\n", err)
+		return -1
+	}
+	if hasErrors(findings) {
+		return 1
 	}
-	g := rback.genGraph()
-	fmt.Println(g.String())
+	return 0
+}
+
+// runLint reports wildcard rules and, if observed API usage was given, suggests narrower replacements
+func (r *Rback) runLint() int {
+	findings := r.lint()
+	if err := r.writeFindings(os.Stdout, lintChecks, findings); err != nil {
+		fmt.Fprintf(os.Stderr, "Can't write findings: %v\n", err)
+		return -1
+	}
+	if r.config.usageFile != "" {
+		usage, err := loadAPIUsage(r.config.usageFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Can't load API usage from %s: %v\n", r.config.usageFile, err)
+			return -1
+		}
+		if err := printSuggestedRules(os.Stdout, r.suggestNarrowedRules(usage)); err != nil {
+			fmt.Fprintf(os.Stderr, "Can't write suggested rules: %v\n", err)
+			return -1
+		}
+	}
+	if hasErrors(findings) {
+		return 1
+	}
+	return 0
+}
+
+// runAudit compares the API usage in audit logs with the granted permissions and returns the process exit code
+func (r *Rback) runAudit() int {
+	var err error
+	if r.config.emitRoles {
+		err = r.printMinimalRoles(os.Stdout, r.auditLog)
+	} else if r.config.auditGraph {
+		fmt.Println(r.genGraph().String())
+	} else {
+		r.printAuditReport(os.Stdout, r.auditLog)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can't write minimal roles: %v\n", err)
+		return -1
+	}
+	return 0
+}
+
+// runCIS reports the status of the CIS Kubernetes Benchmark RBAC controls and returns the process exit code
+func (r *Rback) runCIS() int {
+	findings := r.checkCIS()
+	if r.config.findingsFormat == formatText {
+		printCISReport(os.Stdout, findings, r.permissions.Sources)
+	} else if err := r.writeFindings(os.Stdout, cisChecks(), findings); err != nil {
+		fmt.Fprintf(os.Stderr, "Can't write findings: %v\n", err)
+		return -1
+	}
+	if hasErrors(findings) {
+		return 1
+	}
+	return 0
 }
 
 func parseConfigFromArgs() Config {
 	config := Config{}
 	flag.StringVar(&config.inputFile, "f", "", "The name of the file to use as input (otherwise stdin is used)")
+	flag.BoolVar(&config.fromCluster, "from-cluster", false, "Load the RBAC resources from the current cluster with kubectl instead of the input file or stdin")
+	flag.BoolVar(&config.watch, "watch", false, "Keep watching the input file (or, with --from-cluster, the cluster) and write the output again (or update the served resources) on changes")
 	flag.BoolVar(&config.showLegend, "show-legend", true, "Whether to show the legend or not")
 	flag.BoolVar(&config.showRules, "show-rules", true, "Whether to render RBAC access rules (e.g. \"get pods\") or not")
+	flag.BoolVar(&config.compactRules, "compact-rules", false, "Whether to render access rules in a compact form, merging rules with the same verbs and API groups and leaving out the access granted by broader rules")
+	var auditLogFiles string
+	flag.StringVar(&auditLogFiles, "audit-log", "", "Comma-delimited list of audit log files used to annotate edges and access rules with the number of requests they allowed")
+	flag.StringVar(&config.colorBy, "color-by", "", "Color nodes by the given property: risk (subjects and roles), label=KEY or annotation=KEY")
+	flag.StringVar(&config.groupBy, "group-by", "", "Group nodes within their namespace by the given property: label=KEY or annotation=KEY")
+	var linkTemplate string
+	flag.StringVar(&linkTemplate, "link-template", "", "The URL that graph nodes link to, as a Go template with the fields .Kind, .Namespace and .Name (e.g. https://console/{{.Kind}}/{{.Namespace}}/{{.Name}})")
+	flag.BoolVar(&config.showWorkloads, "show-workloads", true, "Whether to render workloads (Pods, Deployments, etc.) next to the ServiceAccounts they run as")
 	flag.BoolVar(&config.whoCan.showMatchedOnly, "show-matched-rules-only", false, "When running who-can, only show the matched rule instead of all rules specified in the role")
 
+	flag.IntVar(&config.depth, "depth", -1, "When focusing on resources, how many hops over bindings to expand the graph (0 shows just the focused resources, -1 shows directly-related resources)")
+
+	flag.StringVar(&config.view, "view", viewFull, "The projection to render: full, subjects (effective access rules per subject) or roles (subjects collapsed into counts)")
+
+	flag.StringVar(&config.output, "output", outputDot, "The output format: dot, svg (rendered without Graphviz), plantuml, d2, html (interactive report), json, tree, tree-ascii, cypher (Neo4j/Memgraph), graphml, matrix-csv or matrix-md (access matrix with one row per subject)")
+	var themeName string
+	flag.StringVar(&themeName, "theme", themeDefault, "The colors and shapes of the graph: a built-in theme (default, dark, high-contrast or print) or a theme file")
+	flag.StringVar(&config.matrixColumns, "matrix-columns", matrixColumnsResources, "The columns of the access matrix: resources or verbs (one column per verb and resource)")
+
 	var namespaces string
 	flag.StringVar(&namespaces, "n", "", "The namespace to render (also supports multiple, comma-delimited namespaces)")
 
+	var selector string
+	flag.StringVar(&selector, "l", "", "Only render the bindings, roles and ServiceAccounts matching the label selector (e.g. team=payments,env!=dev or tier in (web,api))")
+	flag.StringVar(&selector, "selector", "", "The same as -l")
+
 	var ignoredPrefixes string
-	flag.StringVar(&ignoredPrefixes, "ignore-prefixes", "system:", "Comma-delimited list of (Cluster)Role(Binding) prefixes to ignore ('none' to not ignore anything)")
+	flag.StringVar(&ignoredPrefixes, "ignore-prefixes", "system:", "Comma-delimited list of (Cluster)Role(Binding) prefixes to ignore ('none' to not ignore anything, always the case for cis)")
 	flag.Parse()
 
 	if flag.NArg() > 0 {
-		if flag.Arg(0) == "who-can" {
+		switch flag.Arg(0) {
+		case "who-can":
 			if flag.NArg() < 3 {
 				fmt.Println("Usage: rback who-can VERB RESOURCE [NAME]")
 				os.Exit(-4)
@@ -77,7 +281,57 @@ func parseConfigFromArgs() Config {
 			if flag.NArg() > 3 {
 				config.whoCan.resourceName = flag.Arg(3)
 			}
-		} else {
+		case commandCheck:
+			config.command = commandCheck
+			checkFlags := newFindingsFlagSet(commandCheck, &config)
+			checkFlags.StringVar(&config.policyFile, "policy", "", "The policy file declaring forbidden subjects, roles and access rules")
+			checkFlags.Parse(flag.Args()[1:])
+			if config.policyFile == "" {
+				fmt.Println("Usage: rback check --policy FILE")
+				os.Exit(-4)
+			}
+		case commandCIS:
+			config.command = commandCIS
+			newFindingsFlagSet(commandCIS, &config).Parse(flag.Args()[1:])
+		case commandRisk:
+			config.command = commandRisk
+		case commandLint:
+			config.command = commandLint
+			lintFlags := newFindingsFlagSet(commandLint, &config)
+			lintFlags.StringVar(&config.usageFile, "usage", "", "A file listing observed API usage (one \"VERB RESOURCE[.GROUP]\" per line) used to suggest narrower rules")
+			lintFlags.Parse(flag.Args()[1:])
+			if config.usageFile != "" && config.findingsFormat != formatText {
+				fmt.Println("Usage: rback lint --usage FILE [--format text] (suggested rules are only printed as text)")
+				os.Exit(-4)
+			}
+		case commandAudit:
+			config.command = commandAudit
+			auditFlags := flag.NewFlagSet(commandAudit, flag.ExitOnError)
+			auditFlags.StringVar(&auditLogFiles, "log", auditLogFiles, "Comma-delimited list of audit log files (JSON lines, as written by the apiserver's log backend)")
+			auditFlags.BoolVar(&config.emitRoles, "emit-roles", false, "Print minimal (Cluster)Roles covering the logged API usage of each subject")
+			auditFlags.BoolVar(&config.auditGraph, "graph", false, "Print the graph annotated with the logged requests (same as rback --audit-log FILE)")
+			auditFlags.Parse(flag.Args()[1:])
+			if auditLogFiles == "" {
+				fmt.Println("Usage: rback audit --log FILE[,FILE...] [--emit-roles | --graph]")
+				os.Exit(-4)
+			}
+		case commandServe:
+			config.command = commandServe
+			serveFlags := flag.NewFlagSet(commandServe, flag.ExitOnError)
+			serveFlags.StringVar(&config.addr, "addr", ":8080", "The address to listen on")
+			serveFlags.DurationVar(&config.reloadInterval, "reload", 0, "How often to reload the input file or cluster (e.g. 1m; 0 loads the input once)")
+			serveFlags.Parse(flag.Args()[1:])
+			if config.reloadInterval > 0 && config.inputFile == "" && !config.fromCluster {
+				fmt.Println("Usage: rback -f FILE serve --reload INTERVAL or rback --from-cluster serve --reload INTERVAL")
+				os.Exit(-4)
+			}
+		case commandTUI:
+			config.command = commandTUI
+			if config.inputFile == "" && !config.fromCluster {
+				fmt.Println("Usage: rback -f FILE tui or rback --from-cluster tui (stdin is needed for the keyboard)")
+				os.Exit(-4)
+			}
+		default:
 			config.resourceKind = normalizeKind(flag.Arg(0))
 			if flag.NArg() > 1 {
 				config.resourceNames = flag.Args()[1:]
@@ -87,12 +341,131 @@ func parseConfigFromArgs() Config {
 
 	config.namespaces = strings.Split(namespaces, ",")
 
+	if config.watch && config.inputFile == "" && !config.fromCluster {
+		fmt.Println("Usage: rback -f FILE --watch ... or rback --from-cluster --watch ...")
+		os.Exit(-4)
+	}
+
+	if config.watch && config.command != "" && config.command != commandServe {
+		fmt.Printf("--watch can't be used with %s\n", config.command)
+		os.Exit(-4)
+	}
+
+	if !validView(config.view) {
+		fmt.Printf("Unknown view %s (expected full, subjects or roles)\n", config.view)
+		os.Exit(-4)
+	}
+
+	if !contains(outputFormats, config.output) {
+		fmt.Printf("Unknown output format %s (expected %s)\n", config.output, strings.Join(outputFormats, ", "))
+		os.Exit(-4)
+	}
+
+	if !validColorBy(config.colorBy) {
+		fmt.Printf("Unknown color-by %s (expected risk, label=KEY or annotation=KEY)\n", config.colorBy)
+		os.Exit(-4)
+	}
+
+	if !validGroupBy(config.groupBy) {
+		fmt.Printf("Unknown group-by %s (expected label=KEY or annotation=KEY)\n", config.groupBy)
+		os.Exit(-4)
+	}
+
+	var err error
+	if config.selector, err = parseLabelSelector(selector); err != nil {
+		fmt.Println(err)
+		os.Exit(-4)
+	}
+
+	if linkTemplate != "" {
+		if config.linkTemplate, err = template.New("link").Parse(linkTemplate); err == nil {
+			err = config.linkTemplate.Execute(ioutil.Discard, LinkTarget{})
+		}
+		if err != nil {
+			fmt.Printf("Invalid link template %s: %v\n", linkTemplate, err)
+			os.Exit(-4)
+		}
+	}
+
+	if config.matrixColumns != matrixColumnsResources && config.matrixColumns != matrixColumnsVerbs {
+		fmt.Printf("Unknown matrix columns %s (expected resources or verbs)\n", config.matrixColumns)
+		os.Exit(-4)
+	}
+
+	theme, err := loadTheme(themeName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can't load theme %s: %v\n", themeName, err)
+		os.Exit(-1)
+	}
+	config.theme = theme
+
+	if auditLogFiles != "" {
+		config.auditLogFiles = strings.Split(auditLogFiles, ",")
+	}
+
+	// the CIS controls must be evaluated against all resources, as they are mostly about system: roles and subjects
+	if config.command == commandCIS {
+		if ignoredPrefixes != "none" && flagPassed("ignore-prefixes") {
+			fmt.Println("--ignore-prefixes can't be used with cis (all RBAC resources are evaluated)")
+			os.Exit(-4)
+		}
+		ignoredPrefixes = "none"
+	}
 	if ignoredPrefixes != "none" {
 		config.ignoredPrefixes = strings.Split(ignoredPrefixes, ",")
 	}
 	return config
 }
 
+// flagPassed returns true if the global flag was given on the command line
+func flagPassed(name string) bool {
+	passed := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			passed = true
+		}
+	})
+	return passed
+}
+
+// newFindingsFlagSet creates the flags of a command that reports findings
+func newFindingsFlagSet(command string, config *Config) *flag.FlagSet {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	flags.StringVar(&config.findingsFormat, "format", formatText, "The format of the reported findings (text, sarif or junit)")
+	return flags
+}
+
+const (
+	commandCheck = "check"
+	commandCIS   = "cis"
+	commandRisk  = "risk"
+	commandLint  = "lint"
+	commandAudit = "audit"
+	commandServe = "serve"
+	commandTUI   = "tui"
+)
+
+const (
+	colorByRisk = "risk"
+)
+
+const (
+	outputDot            = "dot"
+	outputHTML           = "html"
+	outputJSON           = "json"
+	outputTree           = "tree"
+	outputTreeASCII      = "tree-ascii"
+	outputCypher         = "cypher"
+	outputGraphML        = "graphml"
+	outputPlantUML       = "plantuml"
+	outputD2             = "d2"
+	outputSVG            = "svg"
+	outputMatrixCSV      = "matrix-csv"
+	outputMatrixMarkdown = "matrix-md"
+)
+
+var outputFormats = []string{outputDot, outputHTML, outputJSON, outputTree, outputTreeASCII, outputCypher, outputGraphML, outputPlantUML, outputD2, outputSVG, outputMatrixCSV, outputMatrixMarkdown}
+
 const (
 	kindServiceAccount     = "serviceaccount"
 	kindRoleBinding        = "rolebinding"
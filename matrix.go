@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	matrixColumnsResources = "resources"
+	matrixColumnsVerbs     = "verbs"
+)
+
+// AccessMatrix holds the access granted to each subject, with one column per resource (or per verb and resource).
+// Each cell maps the namespace scope ("" for cluster-wide) to the verbs granted in it (or, with one column per verb,
+// to the names the access is restricted to).
+type AccessMatrix struct {
+	byVerb   bool
+	subjects []KindNamespacedName
+	columns  []string
+	cells    map[KindNamespacedName]map[string]map[string][]string // map[subject]map[column]map[namespace]verbs
+}
+
+// accessMatrix computes the access matrix of all subjects of the rendered bindings. With who-can, only the matched
+// access rules are included, since a cell can't highlight them like the rules nodes of the graph do.
+func (r *Rback) accessMatrix() *AccessMatrix {
+	matrix := &AccessMatrix{
+		byVerb: r.config.matrixColumns == matrixColumnsVerbs,
+		cells:  map[KindNamespacedName]map[string]map[string][]string{},
+	}
+	subjects, bindingsBySubject := r.selectedSubjects()
+	columns := map[string]bool{}
+	for _, subject := range subjects {
+		matrix.cells[subject] = map[string]map[string][]string{}
+		for _, binding := range bindingsBySubject[subject] {
+			role, found := r.permissions.Roles[binding.role.namespace][binding.role.name]
+			if !found {
+				continue
+			}
+			for _, rule := range role.rules {
+				if r.config.resourceKind == kindRule && !r.config.whoCan.matches(rule) {
+					continue
+				}
+				for _, resource := range rule.matrixResources() {
+					for _, verb := range rule.verbs {
+						column, entry := resource, verb
+						if matrix.byVerb {
+							column, entry = verb+" "+resource, ""
+						}
+						if len(rule.resourceNames) > 0 {
+							entry = strings.TrimSpace(entry + fmt.Sprintf(` "%v"`, strings.Join(rule.resourceNames, ",")))
+						}
+						matrix.add(subject, column, binding.namespace, entry)
+						columns[column] = true
+					}
+				}
+			}
+		}
+		if len(matrix.cells[subject]) > 0 {
+			matrix.subjects = append(matrix.subjects, subject)
+		}
+	}
+	for column := range columns {
+		matrix.columns = append(matrix.columns, column)
+	}
+	sort.Strings(matrix.columns)
+	return matrix
+}
+
+func (m *AccessMatrix) add(subject KindNamespacedName, column, namespace, entry string) {
+	if m.cells[subject][column] == nil {
+		m.cells[subject][column] = map[string][]string{}
+	}
+	if !contains(m.cells[subject][column][namespace], entry) {
+		m.cells[subject][column][namespace] = append(m.cells[subject][column][namespace], entry)
+	}
+}
+
+// matrixResources returns the column names of the resources the rule applies to, e.g. "deployments.apps" for
+// deployments in the apps group, or the URL paths of non-resource rules
+func (r *Rule) matrixResources() []string {
+	resources := []string{}
+	apiGroups := r.apiGroups
+	if len(apiGroups) == 0 {
+		apiGroups = []string{""}
+	}
+	for _, resource := range r.resources {
+		for _, apiGroup := range apiGroups {
+			resources = append(resources, resource+iff(apiGroup == "", "", "."+apiGroup))
+		}
+	}
+	return append(resources, r.nonResourceURLs...)
+}
+
+// cell renders the verbs granted per namespace, e.g. "get,list (cluster-wide); create (prod)". With one column per
+// verb, only the namespaces are listed, e.g. "cluster-wide; prod".
+func (m *AccessMatrix) cell(subject KindNamespacedName, column string) string {
+	verbsByNamespace := m.cells[subject][column]
+	namespaces := []string{}
+	for ns := range verbsByNamespace {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	scopes := []string{}
+	for _, ns := range namespaces {
+		scope := iff(ns == "", "cluster-wide", ns)
+		entries := verbsByNamespace[ns]
+		if m.byVerb && contains(entries, "") {
+			scopes = append(scopes, scope)
+			continue
+		}
+		sort.Strings(entries)
+		scopes = append(scopes, fmt.Sprintf("%s (%s)", strings.Join(entries, ","), scope))
+	}
+	return strings.Join(scopes, "; ")
+}
+
+func (m *AccessMatrix) rows() [][]string {
+	rows := [][]string{append([]string{"Kind", "Namespace", "Name"}, m.columns...)}
+	for _, subject := range m.subjects {
+		row := []string{subject.kind, subject.namespace, subject.name}
+		for _, column := range m.columns {
+			row = append(row, m.cell(subject, column))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// writeCSV writes the matrix as CSV, with a header row naming the columns
+func (m *AccessMatrix) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(m.rows()); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// writeMarkdown writes the matrix as a GitHub-flavored Markdown table
+func (m *AccessMatrix) writeMarkdown(w io.Writer) error {
+	for i, row := range m.rows() {
+		cells := []string{}
+		for _, cell := range row {
+			cells = append(cells, strings.Replace(cell, "|", `\|`, -1))
+		}
+		if _, err := fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | ")); err != nil {
+			return err
+		}
+		if i == 0 {
+			if _, err := fmt.Fprintf(w, "|%s\n", strings.Repeat(" --- |", len(row))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/emicklei/dot"
+)
+
+const (
+	metadataLabel      = "label"
+	metadataAnnotation = "annotation"
+)
+
+// MetadataKey is a label or annotation that nodes are colored or grouped by (e.g. label=team)
+type MetadataKey struct {
+	field string // label or annotation
+	key   string
+}
+
+// parseMetadataKey parses a --color-by or --group-by value of the form label=KEY or annotation=KEY
+func parseMetadataKey(option string) (MetadataKey, bool) {
+	parts := strings.SplitN(option, "=", 2)
+	if len(parts) != 2 || parts[1] == "" || (parts[0] != metadataLabel && parts[0] != metadataAnnotation) {
+		return MetadataKey{}, false
+	}
+	return MetadataKey{parts[0], parts[1]}, true
+}
+
+func (k MetadataKey) String() string {
+	return k.key
+}
+
+// valueOf returns the value of the label or annotation of an object, and whether the object has it
+func (k MetadataKey) valueOf(meta ObjectMeta) (string, bool) {
+	values := meta.labels
+	if k.field == metadataAnnotation {
+		values = meta.annotations
+	}
+	value, found := values[k.key]
+	return value, found
+}
+
+// validColorBy returns true if nodes can be colored by the given property
+func validColorBy(colorBy string) bool {
+	_, isMetadata := parseMetadataKey(colorBy)
+	return colorBy == "" || colorBy == colorByRisk || isMetadata
+}
+
+// validGroupBy returns true if nodes can be grouped by the given property
+func validGroupBy(groupBy string) bool {
+	_, isMetadata := parseMetadataKey(groupBy)
+	return groupBy == "" || isMetadata
+}
+
+// metadataValue returns the value of the label or annotation of an object, and whether the object has it
+func (r *Rback) metadataValue(key MetadataKey, object KindNamespacedName) (string, bool) {
+	meta, found := r.permissions.Metadata[object]
+	if !found {
+		return "", false
+	}
+	return key.valueOf(meta)
+}
+
+// metadataValues returns the sorted values of the label or annotation across all objects. Colors are assigned in this
+// order, so that a value has the same color no matter which part of the graph is rendered.
+func (r *Rback) metadataValues(key MetadataKey) []string {
+	found := map[string]bool{}
+	for _, meta := range r.permissions.Metadata {
+		if value, ok := key.valueOf(meta); ok {
+			found[value] = true
+		}
+	}
+	values := []string{}
+	for value := range found {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return values
+}
+
+// metadataColor returns the fill color of a label or annotation value, or "" if the theme has no palette
+func (r *Rback) metadataColor(key MetadataKey, value string) string {
+	if r.metadataColors == nil {
+		r.metadataColors = map[string]string{}
+		palette := r.config.theme.Palette.Colors
+		for i, v := range r.metadataValues(key) {
+			if len(palette) > 0 {
+				r.metadataColors[v] = palette[i%len(palette)]
+			}
+		}
+	}
+	return r.metadataColors[value]
+}
+
+// objectColor returns the fill color of an object when coloring by a label or annotation, or "" if the graph isn't
+// colored by a label or annotation or the object doesn't have it
+func (r *Rback) objectColor(object KindNamespacedName) string {
+	key, ok := parseMetadataKey(r.config.colorBy)
+	if !ok {
+		return ""
+	}
+	if value, ok := r.metadataValue(key, object); ok {
+		return r.metadataColor(key, value)
+	}
+	return ""
+}
+
+// colorFontColor returns the font color of nodes whose fill color is overridden by --color-by
+func (r *Rback) colorFontColor() string {
+	if r.config.colorBy == colorByRisk {
+		return r.config.theme.Risk.FontColor
+	}
+	return r.config.theme.Palette.FontColor
+}
+
+// applyMetadataColor overrides the fill color of a node with the color of its label or annotation value
+func (r *Rback) applyMetadataColor(node dot.Node, object KindNamespacedName) {
+	if color := r.objectColor(object); color != "" {
+		node.Attr("fillcolor", color).Attr("fontcolor", r.config.theme.Palette.FontColor)
+	}
+}
+
+func (r *Rback) renderMetadataLegend(legend *dot.Graph) {
+	key, _ := parseMetadataKey(r.config.colorBy)
+	for _, value := range r.metadataValues(key) {
+		legend.Node("meta-"+value).Box().
+			Attr("label", fmt.Sprintf("%s=%s", key, value)).
+			Attr("style", "filled").
+			Attr("fillcolor", r.metadataColor(key, value)).
+			Attr("fontcolor", r.config.theme.Palette.FontColor)
+	}
+}
+
+// groupSubgraph returns the subgraph of the object's group within the subgraph of the namespace ns when grouping by a
+// label or annotation, or the namespace subgraph if the graph isn't grouped or the object doesn't have the label or
+// annotation. ns is the namespace the object is drawn in, which differs from its own for ClusterRoles bound by
+// RoleBindings.
+func (r *Rback) groupSubgraph(gns *dot.Graph, ns string, object KindNamespacedName) *dot.Graph {
+	if label := r.groupLabel(object); label != "" {
+		return newGroupSubgraph(gns, r.config.theme, ns, label)
+	}
+	return gns
+}
+
+// groupLabel returns the label of the object's group (e.g. "team=payments"), or "" if the object isn't grouped
+func (r *Rback) groupLabel(object KindNamespacedName) string {
+	key, ok := parseMetadataKey(r.config.groupBy)
+	if !ok {
+		return ""
+	}
+	if value, ok := r.metadataValue(key, object); ok {
+		return fmt.Sprintf("%s=%s", key, value)
+	}
+	return ""
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	nodeTypeWorkload = "workload"
+	nodeTypeSubject  = "subject"
+	nodeTypeBinding  = "binding"
+	nodeTypeRole     = "role"
+)
+
+// GraphModel is the graph with the same selection as the rendered dot graph, but independent of any output format.
+// It's used by outputs that do their own rendering (e.g. the HTML report).
+type GraphModel struct {
+	Nodes []*GraphNode `json:"nodes"`
+	Edges []*GraphEdge `json:"edges"`
+	nodes map[string]*GraphNode
+	edges map[[2]string]*GraphEdge
+}
+
+// GraphNode is a workload, subject, binding or role. Its ID is unique across all nodes (e.g. "Role ns/name").
+type GraphNode struct {
+	ID          string            `json:"id"`
+	Type        string            `json:"type"`
+	Kind        string            `json:"kind"`
+	Namespace   string            `json:"namespace,omitempty"`
+	Name        string            `json:"name"`
+	Missing     bool              `json:"missing,omitempty"`
+	Focused     bool              `json:"focused,omitempty"`
+	NoToken     bool              `json:"noToken,omitempty"` // workloads whose Pods don't get the ServiceAccount token mounted
+	Risk        *int              `json:"risk,omitempty"`
+	Color       string            `json:"color,omitempty"` // overrides the fill color of the node's type (e.g. when coloring by risk)
+	Group       string            `json:"group,omitempty"` // the label or annotation value the node is grouped by (e.g. "team=payments")
+	Rules       []string          `json:"rules,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Tooltip     string            `json:"tooltip,omitempty"` // the full object, as in the tooltips of the dot output
+	URL         string            `json:"url,omitempty"`     // built from --link-template
+}
+
+// GraphEdge links a workload to its ServiceAccount, a subject to a binding or a binding to its role. Hits is only set
+// if audit logs were given.
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Hits *int   `json:"hits,omitempty"`
+}
+
+// graphModel builds the model of the full view, selecting the same resources as genGraph
+func (r *Rback) graphModel() *GraphModel {
+	m := &GraphModel{nodes: map[string]*GraphNode{}, edges: map[[2]string]*GraphEdge{}}
+
+	for _, bindings := range r.permissions.RoleBindings {
+		for _, binding := range bindings {
+			if !r.shouldRenderBinding(binding) {
+				continue
+			}
+			bindingNode := r.addBindingNode(m, binding)
+			roleNode := r.addRoleNode(m, binding.role)
+			m.addEdge(bindingNode, roleNode, r.modelHits(r.bindingHits(binding.NamespacedName)))
+			for _, subject := range binding.subjects {
+				if r.shouldRenderSubject(subject) {
+					subjectNode := r.addSubjectNode(m, subject)
+					m.addEdge(subjectNode, bindingNode, r.modelHits(r.subjectBindingHits(subject, binding.NamespacedName)))
+				}
+			}
+		}
+	}
+	for _, sa := range r.selectedServiceAccounts() {
+		r.addSubjectNode(m, sa)
+	}
+	for _, role := range r.selectedRoles() {
+		r.addRoleNode(m, role)
+	}
+	if r.depthLimited() {
+		n := r.neighborhood()
+		for _, subject := range n.subjects {
+			r.addSubjectNode(m, subject)
+		}
+		for _, role := range n.roles {
+			r.addRoleNode(m, role)
+		}
+		for _, binding := range n.focusedBindings {
+			r.addBindingNode(m, binding)
+		}
+	}
+
+	sort.Slice(m.Nodes, func(i, j int) bool { return m.Nodes[i].ID < m.Nodes[j].ID })
+	sort.Slice(m.Edges, func(i, j int) bool {
+		if m.Edges[i].From != m.Edges[j].From {
+			return m.Edges[i].From < m.Edges[j].From
+		}
+		return m.Edges[i].To < m.Edges[j].To
+	})
+	return m
+}
+
+// writeJSON writes the graph model as JSON
+func (r *Rback) writeJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r.graphModel())
+}
+
+// addNode adds the node to the model, unless a node with the same ID already exists, and returns the node in the model
+func (m *GraphModel) addNode(node *GraphNode) *GraphNode {
+	if existing, found := m.nodes[node.ID]; found {
+		return existing
+	}
+	m.nodes[node.ID] = node
+	m.Nodes = append(m.Nodes, node)
+	return node
+}
+
+// addEdge adds an edge between two nodes, unless it already exists
+func (m *GraphModel) addEdge(from, to *GraphNode, hits *int) {
+	key := [2]string{from.ID, to.ID}
+	if _, found := m.edges[key]; found {
+		return
+	}
+	edge := &GraphEdge{From: from.ID, To: to.ID, Hits: hits}
+	m.edges[key] = edge
+	m.Edges = append(m.Edges, edge)
+}
+
+// modelHits returns the number of logged requests, or nil if no audit logs were given
+func (r *Rback) modelHits(hits int) *int {
+	if r.auditLog == nil {
+		return nil
+	}
+	return &hits
+}
+
+func (r *Rback) addBindingNode(m *GraphModel, binding Binding) *GraphNode {
+	ref := bindingRef(binding)
+	return m.addNode(r.withMetadata(&GraphNode{
+		ID:        ref.String(),
+		Type:      nodeTypeBinding,
+		Kind:      ref.kind,
+		Namespace: binding.namespace,
+		Name:      binding.name,
+		Focused:   r.isFocused(strings.ToLower(ref.kind), binding.namespace, binding.name),
+	}, ref))
+}
+
+func (r *Rback) addRoleNode(m *GraphModel, role NamespacedName) *GraphNode {
+	ref := roleRef(role)
+	if existing, found := m.nodes[ref.String()]; found {
+		return existing
+	}
+	node := m.addNode(r.withMetadata(&GraphNode{
+		ID:        ref.String(),
+		Type:      nodeTypeRole,
+		Kind:      ref.kind,
+		Namespace: role.namespace,
+		Name:      role.name,
+		Missing:   !r.roleExists(role),
+		Focused:   r.isFocused(strings.ToLower(ref.kind), role.namespace, role.name) || r.ruleMatchesSelection(role),
+	}, ref))
+	if r.config.colorBy == colorByRisk && !node.Missing {
+		score := r.risk().roles[role]
+		node.Risk, node.Color = &score, r.config.theme.riskColor(score)
+	}
+	if r.config.showRules {
+		for _, rule := range r.renderedRules(r.permissions.Roles[role.namespace][role.name]) {
+			node.Rules = append(node.Rules, rule.toHumanReadableString())
+		}
+	}
+	return node
+}
+
+func (r *Rback) addSubjectNode(m *GraphModel, subject KindNamespacedName) *GraphNode {
+	if existing, found := m.nodes[subject.String()]; found {
+		return existing
+	}
+	node := m.addNode(r.withMetadata(&GraphNode{
+		ID:        subject.String(),
+		Type:      nodeTypeSubject,
+		Kind:      subject.kind,
+		Namespace: subject.namespace,
+		Name:      subject.name,
+		Missing:   !r.subjectExists(subject.kind, subject.namespace, subject.name),
+		Focused:   r.isFocused(strings.ToLower(subject.kind), subject.namespace, subject.name),
+	}, subject))
+	if r.config.colorBy == colorByRisk && !node.Missing {
+		score := r.risk().subjects[subject]
+		node.Risk, node.Color = &score, r.config.theme.riskColor(score)
+	}
+	if subject.kind == "ServiceAccount" && r.config.showWorkloads {
+		for _, workload := range r.permissions.Workloads[subject.namespace] {
+			if workload.serviceAccount == subject.name {
+				workloadNode := m.addNode(r.withMetadata(&GraphNode{
+					ID:        workload.KindNamespacedName.String(),
+					Type:      nodeTypeWorkload,
+					Kind:      workload.kind,
+					Namespace: workload.namespace,
+					Name:      workload.name,
+					NoToken:   !r.mountsToken(workload),
+				}, workload.KindNamespacedName))
+				m.addEdge(workloadNode, node, nil)
+			}
+		}
+	}
+	return node
+}
+
+// withMetadata sets the labels and annotations of a node, and its color and group when coloring or grouping by a label
+// or annotation
+func (r *Rback) withMetadata(node *GraphNode, object KindNamespacedName) *GraphNode {
+	if meta, found := r.permissions.Metadata[object]; found {
+		if len(meta.labels) > 0 {
+			node.Labels = meta.labels
+		}
+		if len(meta.annotations) > 0 {
+			node.Annotations = meta.annotations
+		}
+	}
+	node.Color = r.objectColor(object)
+	node.Group = r.groupLabel(object)
+	node.Tooltip = r.objectTooltip(object)
+	node.URL = r.objectURL(object)
+	return node
+}
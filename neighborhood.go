@@ -0,0 +1,132 @@
+package main
+
+// Neighborhood holds the resources within a number of hops from the focused resources. One hop goes from a subject or
+// role to the bindings referring to it, which brings in the bindings' other subjects and roles for the next hop.
+type Neighborhood struct {
+	subjects        []KindNamespacedName // focused subjects
+	roles           []NamespacedName     // focused roles
+	focusedBindings []Binding
+	bindings        map[NamespacedName]bool // bindings within depth hops
+}
+
+// neighborhood returns the neighborhood of the focused resources, computing it on first use
+func (r *Rback) neighborhood() *Neighborhood {
+	if r.focusNeighborhood == nil {
+		r.focusNeighborhood = r.computeNeighborhood(r.config.depth)
+	}
+	return r.focusNeighborhood
+}
+
+func (r *Rback) computeNeighborhood(depth int) *Neighborhood {
+	n := &Neighborhood{bindings: map[NamespacedName]bool{}}
+	subjects, roles := map[KindNamespacedName]bool{}, map[NamespacedName]bool{}
+
+	// hop 0: the focused resources themselves (focused bindings count as the first hop, as they bring in their subjects and role)
+	for _, bindings := range r.permissions.RoleBindings {
+		for _, binding := range bindings {
+			for _, subject := range binding.subjects {
+				if r.isFocusedSubject(subject) && !subjects[subject] {
+					subjects[subject] = true
+					n.subjects = append(n.subjects, subject)
+				}
+			}
+			if r.isFocusedBinding(binding) {
+				n.focusedBindings = append(n.focusedBindings, binding)
+			}
+		}
+	}
+	for ns, sas := range r.permissions.ServiceAccounts {
+		for sa := range sas {
+			subject := KindNamespacedName{"ServiceAccount", NamespacedName{ns, sa}}
+			if r.isFocusedSubject(subject) && !subjects[subject] {
+				subjects[subject] = true
+				n.subjects = append(n.subjects, subject)
+			}
+		}
+	}
+	for _, rs := range r.permissions.Roles {
+		for _, role := range rs {
+			if r.isFocusedRole(role.NamespacedName) {
+				roles[role.NamespacedName] = true
+				n.roles = append(n.roles, role.NamespacedName)
+			}
+		}
+	}
+	if depth == 0 {
+		return n
+	}
+	for _, binding := range n.focusedBindings {
+		n.bindings[binding.NamespacedName] = true
+	}
+
+	// hops 1..depth: add all bindings referring to a subject or role reached so far
+	for hop := 1; hop <= depth; hop++ {
+		added := []Binding{}
+		for _, bindings := range r.permissions.RoleBindings {
+			for _, binding := range bindings {
+				if n.bindings[binding.NamespacedName] {
+					if hop == 1 {
+						added = append(added, binding) // focused bindings bring in their subjects and role
+					}
+					continue
+				}
+				if roles[binding.role] || bindsAnyOf(binding, subjects) {
+					n.bindings[binding.NamespacedName] = true
+					added = append(added, binding)
+				}
+			}
+		}
+		if len(added) == 0 {
+			break
+		}
+		for _, binding := range added {
+			roles[binding.role] = true
+			for _, subject := range binding.subjects {
+				subjects[subject] = true
+			}
+		}
+	}
+	return n
+}
+
+func bindsAnyOf(binding Binding, subjects map[KindNamespacedName]bool) bool {
+	for _, subject := range binding.subjects {
+		if subjects[subject] {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rback) isFocusedSubject(subject KindNamespacedName) bool {
+	kind := normalizeKind(subject.kind)
+	if kind != r.config.resourceKind || !r.resourceNameSelected(subject.name) {
+		return false
+	}
+	if kind == kindServiceAccount {
+		return r.namespaceSelected(subject.namespace) && r.subjectExists(subject.kind, subject.namespace, subject.name)
+	}
+	return true
+}
+
+func (r *Rback) isFocusedBinding(binding Binding) bool {
+	switch r.config.resourceKind {
+	case kindRoleBinding:
+		return binding.namespace != "" && r.namespaceSelected(binding.namespace) && r.resourceNameSelected(binding.name)
+	case kindClusterRoleBinding:
+		return binding.namespace == "" && r.resourceNameSelected(binding.name)
+	}
+	return false
+}
+
+func (r *Rback) isFocusedRole(role NamespacedName) bool {
+	switch r.config.resourceKind {
+	case kindRole:
+		return role.namespace != "" && r.namespaceSelected(role.namespace) && r.resourceNameSelected(role.name)
+	case kindClusterRole:
+		return role.namespace == "" && r.resourceNameSelected(role.name)
+	case kindRule:
+		return r.ruleMatchesSelection(role) && (role.namespace == "" || r.namespaceSelected(role.namespace))
+	}
+	return false
+}
@@ -1,66 +1,215 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"strings"
 )
 
 // parseRBAC parses RBAC resources from the given reader and stores them in maps under r.permissions
 func (r *Rback) parseRBAC(reader io.Reader) (err error) {
-	var input map[string]interface{}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
 
-	decoder := json.NewDecoder(reader)
-	err = decoder.Decode(&input)
+	kind, items, offsets, err := decodeList(data)
 	if err != nil {
 		return err
 	}
 
-	if input["kind"] != "List" {
-		return fmt.Errorf("Expected kind=List, but found %v", input["kind"])
+	if kind != "List" {
+		return fmt.Errorf("Expected kind=List, but found %v", kind)
 	}
 
-	r.permissions.ServiceAccounts = make(map[string]map[string]string)
-	r.permissions.Roles = make(map[string]map[string]Role)
-	r.permissions.RoleBindings = make(map[string]map[string]Binding)
+	r.permissions = newPermissions()
+	locator := newSourceLocator(r.config.inputFile, data)
+	for i, item := range items {
+		r.applyObject(item, locator.position(offsets[i]))
+	}
+	return nil
+}
 
-	items := input["items"].([]interface{})
-	for _, i := range items {
-		item := i.(map[string]interface{})
-		nn := getNamespacedName(getMetadata(item))
+func newPermissions() Permissions {
+	return Permissions{
+		ServiceAccounts: make(map[string]map[string]string),
+		Roles:           make(map[string]map[string]Role),
+		RoleBindings:    make(map[string]map[string]Binding),
+		Sources:         make(map[KindNamespacedName]SourcePosition),
+		Metadata:        make(map[KindNamespacedName]ObjectMeta),
+		Workloads:       make(map[string][]Workload),
+	}
+}
 
-		if r.shouldIgnore(nn.name) {
-			continue
+// applyObject adds the object to r.permissions, replacing an existing object of the same kind, namespace and name. The
+// source position and metadata are only kept for the objects that are stored.
+func (r *Rback) applyObject(item map[string]interface{}, pos SourcePosition) {
+	metadata := getMetadata(item)
+	nn := getNamespacedName(metadata)
+
+	if r.shouldIgnore(nn.name) {
+		return
+	}
+
+	kind := item["kind"].(string)
+	object := KindNamespacedName{kind, nn}
+	stored := true
+	switch kind {
+	case "ServiceAccount":
+		if r.permissions.ServiceAccounts[nn.namespace] == nil {
+			r.permissions.ServiceAccounts[nn.namespace] = make(map[string]string)
+		}
+		json, _ := struct2json(item)
+		r.permissions.ServiceAccounts[nn.namespace][nn.name] = json
+	case "RoleBinding", "ClusterRoleBinding":
+		if r.permissions.RoleBindings[nn.namespace] == nil {
+			r.permissions.RoleBindings[nn.namespace] = make(map[string]Binding)
+		}
+		r.permissions.RoleBindings[nn.namespace][nn.name] = r.toBinding(item)
+	case "Role", "ClusterRole":
+		if r.permissions.Roles[nn.namespace] == nil {
+			r.permissions.Roles[nn.namespace] = make(map[string]Role)
 		}
+		r.permissions.Roles[nn.namespace][nn.name] = toRole(item)
+	case "Pod", "Deployment", "StatefulSet", "DaemonSet", "Job", "CronJob":
+		r.removeWorkload(object)
+		// Pods and Jobs created by controllers are represented by their controller
+		if isControlled(item) {
+			stored = false
+		} else {
+			r.permissions.Workloads[nn.namespace] = append(r.permissions.Workloads[nn.namespace], toWorkload(item))
+		}
+	default:
+		log.Printf("Ignoring resource kind %s", kind)
+		stored = false
+	}
 
-		kind := item["kind"].(string)
+	if stored {
+		r.permissions.Sources[object] = pos
+		r.permissions.Metadata[object] = toObjectMeta(metadata)
+	} else {
+		delete(r.permissions.Sources, object)
+		delete(r.permissions.Metadata, object)
+	}
+}
 
-		switch kind {
-		case "ServiceAccount":
-			if r.permissions.ServiceAccounts[nn.namespace] == nil {
-				r.permissions.ServiceAccounts[nn.namespace] = make(map[string]string)
+// deleteObject removes the object from r.permissions
+func (r *Rback) deleteObject(object KindNamespacedName) {
+	delete(r.permissions.Sources, object)
+	delete(r.permissions.Metadata, object)
+	switch object.kind {
+	case "ServiceAccount":
+		delete(r.permissions.ServiceAccounts[object.namespace], object.name)
+	case "RoleBinding", "ClusterRoleBinding":
+		delete(r.permissions.RoleBindings[object.namespace], object.name)
+	case "Role", "ClusterRole":
+		delete(r.permissions.Roles[object.namespace], object.name)
+	default:
+		r.removeWorkload(object)
+	}
+}
+
+func (r *Rback) removeWorkload(object KindNamespacedName) {
+	workloads := r.permissions.Workloads[object.namespace]
+	for i, workload := range workloads {
+		if workload.KindNamespacedName == object {
+			r.permissions.Workloads[object.namespace] = append(workloads[:i:i], workloads[i+1:]...)
+			return
+		}
+	}
+}
+
+// decodeList decodes a List of objects and records the offset of each item in the input, so that parsed objects
+// can be traced back to their position in the manifest file
+func decodeList(data []byte) (kind string, items []map[string]interface{}, offsets []int64, err error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if err = expectDelim(decoder, '{'); err != nil {
+		return
+	}
+	for decoder.More() {
+		var key json.Token
+		key, err = decoder.Token()
+		if err != nil {
+			return
+		}
+		switch key {
+		case "items":
+			if err = expectDelim(decoder, '['); err != nil {
+				return
 			}
-			json, _ := struct2json(item)
-			r.permissions.ServiceAccounts[nn.namespace][nn.name] = json
-		case "RoleBinding", "ClusterRoleBinding":
-			if r.permissions.RoleBindings[nn.namespace] == nil {
-				r.permissions.RoleBindings[nn.namespace] = make(map[string]Binding)
+			for decoder.More() {
+				offset := decoder.InputOffset()
+				var item map[string]interface{}
+				if err = decoder.Decode(&item); err != nil {
+					return
+				}
+				items = append(items, item)
+				offsets = append(offsets, offset)
 			}
-			r.permissions.RoleBindings[nn.namespace][nn.name] = r.toBinding(item)
-		case "Role", "ClusterRole":
-			if r.permissions.Roles[nn.namespace] == nil {
-				r.permissions.Roles[nn.namespace] = make(map[string]Role)
+			if err = expectDelim(decoder, ']'); err != nil {
+				return
 			}
-			r.permissions.Roles[nn.namespace][nn.name] = toRole(item)
+		case "kind":
+			var value interface{}
+			if err = decoder.Decode(&value); err != nil {
+				return
+			}
+			kind, _ = value.(string)
 		default:
-			log.Printf("Ignoring resource kind %s", kind)
+			var ignored interface{}
+			if err = decoder.Decode(&ignored); err != nil {
+				return
+			}
 		}
 	}
+	err = expectDelim(decoder, '}')
+	return
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("Expected %v, but found %v", delim, token)
+	}
 	return nil
 }
 
+// sourceLocator converts the increasing offsets of the items in the input into lines and columns. It only counts the
+// lines between consecutive offsets, so that locating all items takes a single pass over the input.
+type sourceLocator struct {
+	file      string
+	data      []byte
+	offset    int64 // the offset of the last located item
+	line      int   // the line of the last located item
+	lineStart int64 // the offset of the first character in that line
+}
+
+func newSourceLocator(file string, data []byte) *sourceLocator {
+	return &sourceLocator{file: file, data: data, line: 1}
+}
+
+// position converts an offset into line and column (skipping the whitespace and comma preceding an item). The offset
+// must not be smaller than the previous one.
+func (l *sourceLocator) position(offset int64) SourcePosition {
+	for offset < int64(len(l.data)) && strings.ContainsRune(" \t\r\n,", rune(l.data[offset])) {
+		offset++
+	}
+	skipped := l.data[l.offset:offset]
+	l.line += bytes.Count(skipped, []byte("\n"))
+	if i := bytes.LastIndexByte(skipped, '\n'); i >= 0 {
+		l.lineStart = l.offset + int64(i) + 1
+	}
+	l.offset = offset
+	return SourcePosition{file: l.file, line: l.line, column: int(offset-l.lineStart) + 1}
+}
+
 func (r *Rback) shouldIgnore(name string) bool {
 	for _, prefix := range r.config.ignoredPrefixes {
 		if strings.HasPrefix(name, prefix) {
@@ -90,6 +239,14 @@ func getMetadata(obj map[string]interface{}) map[string]interface{} {
 	return metadata
 }
 
+func toObjectMeta(metadata map[string]interface{}) ObjectMeta {
+	return ObjectMeta{
+		labels:            toStringMap(metadata["labels"]),
+		annotations:       toStringMap(metadata["annotations"]),
+		creationTimestamp: stringOrEmpty(metadata["creationTimestamp"]),
+	}
+}
+
 func toRole(rawRole map[string]interface{}) Role {
 	rules := []Rule{}
 	if rawRole["rules"] != nil {
@@ -105,12 +262,14 @@ func toRole(rawRole map[string]interface{}) Role {
 }
 
 func (r *Rback) toBinding(rawBinding map[string]interface{}) Binding {
-	subjects := []KindNamespacedName{}
+	subjects, ignoredSubjects := []KindNamespacedName{}, []KindNamespacedName{}
 	if rawBinding["subjects"] != nil {
 		rawSubjects := rawBinding["subjects"].([]interface{})
 		for _, s := range rawSubjects {
 			subject := toKindNamespacedName(s)
-			if !r.shouldIgnore(subject.name) {
+			if r.shouldIgnore(subject.name) {
+				ignoredSubjects = append(ignoredSubjects, subject)
+			} else {
 				subjects = append(subjects, subject)
 			}
 		}
@@ -124,12 +283,67 @@ func (r *Rback) toBinding(rawBinding map[string]interface{}) Binding {
 		role.namespace = bindingNn.namespace
 	}
 	return Binding{
-		NamespacedName: bindingNn,
-		role:           role,
-		subjects:       subjects,
+		NamespacedName:  bindingNn,
+		role:            role,
+		subjects:        subjects,
+		ignoredSubjects: ignoredSubjects,
 	}
 }
 
+func toWorkload(rawWorkload map[string]interface{}) Workload {
+	podSpec := getPodSpec(rawWorkload)
+	serviceAccount := stringOrEmpty(podSpec["serviceAccountName"])
+	if serviceAccount == "" {
+		serviceAccount = stringOrEmpty(podSpec["serviceAccount"]) // deprecated alias of serviceAccountName
+	}
+	if serviceAccount == "" {
+		serviceAccount = "default"
+	}
+	var automountToken *bool
+	if automount, ok := podSpec["automountServiceAccountToken"].(bool); ok {
+		automountToken = &automount
+	}
+	return Workload{
+		KindNamespacedName: KindNamespacedName{rawWorkload["kind"].(string), getNamespacedName(getMetadata(rawWorkload))},
+		serviceAccount:     serviceAccount,
+		automountToken:     automountToken,
+	}
+}
+
+// getPodSpec returns the spec of a Pod or the spec of the Pod template of a controller
+func getPodSpec(rawWorkload map[string]interface{}) map[string]interface{} {
+	path := []string{"spec", "template", "spec"}
+	switch rawWorkload["kind"] {
+	case "Pod":
+		path = []string{"spec"}
+	case "CronJob":
+		path = []string{"spec", "jobTemplate", "spec", "template", "spec"}
+	}
+	obj := rawWorkload
+	for _, field := range path {
+		child, ok := obj[field].(map[string]interface{})
+		if !ok {
+			return map[string]interface{}{}
+		}
+		obj = child
+	}
+	return obj
+}
+
+func isControlled(obj map[string]interface{}) bool {
+	ownerReferences, _ := getMetadata(obj)["ownerReferences"].([]interface{})
+	for _, ref := range ownerReferences {
+		owner, ok := ref.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if controller, _ := owner["controller"].(bool); controller {
+			return true
+		}
+	}
+	return false
+}
+
 func stringOrEmpty(i interface{}) string {
 	if i == nil {
 		return ""
@@ -159,6 +373,16 @@ func toStringArray(values interface{}) []string {
 	return strs
 }
 
+func toStringMap(values interface{}) map[string]string {
+	strs := map[string]string{}
+	if m, ok := values.(map[string]interface{}); ok {
+		for k, v := range m {
+			strs[k], _ = v.(string)
+		}
+	}
+	return strs
+}
+
 // struct2json turns a map into a JSON string
 func struct2json(s map[string]interface{}) (string, error) {
 	str, err := json.Marshal(s)
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// plantUMLElements are the PlantUML elements standing in for the dot shapes. PlantUML has no octagons, so bindings
+// and roles are drawn as hexagons, cluster-scoped ones with a bold outline. Other shapes are drawn as rectangles.
+var plantUMLElements = map[string]string{
+	diagramShapeBox:           "rectangle",
+	diagramShapeComponent:     "component",
+	diagramShapeOctagon:       "hexagon",
+	diagramShapeDoubleOctagon: "hexagon",
+	diagramShapeNote:          "file",
+}
+
+// writePlantUML writes the diagram as a PlantUML deployment diagram
+func (r *Rback) writePlantUML(w io.Writer) error {
+	d := r.genDiagram()
+	d.assignIDs()
+
+	var out bytes.Buffer
+	t := d.theme
+	out.WriteString("@startuml\n")
+	if t.leftToRight() {
+		out.WriteString("left to right direction\n")
+	}
+	if t.Background != "" {
+		fmt.Fprintf(&out, "skinparam backgroundColor %s\n", t.Background)
+	}
+	if t.Edge.Color != "" {
+		fmt.Fprintf(&out, "skinparam arrowColor %s\n", t.Edge.Color)
+	}
+	if t.FontColor != "" {
+		fmt.Fprintf(&out, "skinparam defaultFontColor %s\n", t.FontColor)
+	}
+	writePlantUMLCluster(&out, t, d.root, "")
+	for _, edge := range d.edges {
+		arrow := iff(edge.faded, "-["+plantUMLColor(t.UnusedEdge.Color)+"dashed]-", "--")
+		if edge.back {
+			arrow = "<" + arrow
+		} else {
+			arrow += ">"
+		}
+		fmt.Fprintf(&out, "%s %s %s", edge.from.id, arrow, edge.to.id)
+		if edge.label != "" {
+			fmt.Fprintf(&out, " : %s", edge.label)
+		}
+		out.WriteString("\n")
+	}
+	out.WriteString("@enduml\n")
+	_, err := out.WriteTo(w)
+	return err
+}
+
+func writePlantUMLCluster(out *bytes.Buffer, t *Theme, c *DiagramCluster, indent string) {
+	for _, node := range c.sortedNodes() {
+		element, found := plantUMLElements[node.shape]
+		if !found {
+			element = "rectangle"
+		}
+		fmt.Fprintf(out, "%s%s \"%s\" as %s %s\n", indent, element, plantUMLLabel(t, node.lines), node.id, plantUMLStyle(node))
+	}
+	for _, cluster := range c.sortedClusters() {
+		style := ""
+		if cluster.dashed {
+			style = " #line.dashed"
+			if t.Namespace.Color != "" {
+				style += ";line:" + strings.TrimPrefix(t.Namespace.Color, "#")
+			}
+		}
+		fmt.Fprintf(out, "%srectangle \"%s\" as %s%s {\n", indent, plantUMLEscape(cluster.label), cluster.id, style)
+		writePlantUMLCluster(out, t, cluster, indent+"  ")
+		fmt.Fprintf(out, "%s}\n", indent)
+	}
+}
+
+// plantUMLStyle returns the inline style of a node (e.g. "#ff9900;line:red;line.dotted;text:030303")
+func plantUMLStyle(node *DiagramNode) string {
+	style := []string{"#" + strings.TrimPrefix(iff(node.fill == "", "white", node.fill), "#")}
+	if node.border != "" {
+		style = append(style, "line:"+strings.TrimPrefix(node.border, "#"))
+	}
+	if node.dotted {
+		style = append(style, "line.dotted")
+	} else if node.dashed {
+		style = append(style, "line.dashed")
+	} else if node.shape == diagramShapeDoubleOctagon {
+		style = append(style, "line.bold")
+	}
+	if node.fontColor != "" {
+		style = append(style, "text:"+strings.TrimPrefix(node.fontColor, "#"))
+	}
+	return strings.Join(style, ";")
+}
+
+// plantUMLLabel formats the lines of a label with Creole markup
+func plantUMLLabel(t *Theme, lines []DiagramLine) string {
+	texts := []string{}
+	for _, line := range lines {
+		text := plantUMLEscape(line.text)
+		if line.bold {
+			text = "**" + text + "**"
+		} else if line.faded {
+			text = "<color:" + t.FadedText + ">" + text + "</color>"
+		}
+		texts = append(texts, text)
+	}
+	return strings.Join(texts, `\n`)
+}
+
+// plantUMLColor returns the color of an arrow style (e.g. "#c0c0c0,"), or nothing if the color isn't set
+func plantUMLColor(color string) string {
+	if color == "" {
+		return ""
+	}
+	return "#" + strings.TrimPrefix(color, "#") + ","
+}
+
+func plantUMLEscape(str string) string {
+	str = strings.ReplaceAll(str, `\`, `\\`)
+	return strings.ReplaceAll(str, `"`, `&#34;`)
+}
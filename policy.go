@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Policy is a set of organization-specific rules that rback check evaluates against the parsed RBAC resources
+type Policy struct {
+	Rules []PolicyRule `yaml:"rules"`
+}
+
+// PolicyRule forbids certain subjects, roles or access rules in the (Cluster)Roles and (Cluster)RoleBindings it matches
+type PolicyRule struct {
+	Name        string       `yaml:"name"`
+	Description string       `yaml:"description"`
+	Severity    string       `yaml:"severity"`
+	Match       PolicyMatch  `yaml:"match"`
+	Forbid      PolicyForbid `yaml:"forbid"`
+}
+
+// PolicyMatch selects the objects a PolicyRule applies to. Namespaces, names and exceptions are glob patterns (e.g. "prod-*").
+type PolicyMatch struct {
+	Kinds      []string `yaml:"kinds"`
+	Namespaces []string `yaml:"namespaces"`
+	Names      []string `yaml:"names"`
+	Except     []string `yaml:"except"`
+}
+
+// PolicyForbid lists the patterns that must not occur in a matched object. Subjects and roles only apply to bindings;
+// rules apply to roles directly and to bindings through the role they refer to, unless that role is matched itself.
+type PolicyForbid struct {
+	Subjects []SubjectPattern `yaml:"subjects"`
+	Roles    []RolePattern    `yaml:"roles"`
+	Rules    []RulePattern    `yaml:"rules"`
+}
+
+type SubjectPattern struct {
+	Kind      string `yaml:"kind"`
+	Namespace string `yaml:"namespace"`
+	Name      string `yaml:"name"`
+}
+
+type RolePattern struct {
+	Kind string `yaml:"kind"`
+	Name string `yaml:"name"`
+}
+
+// RulePattern matches an access rule if, for each non-empty field, the rule contains one of the listed values
+// (or a wildcard covering it)
+type RulePattern struct {
+	Verbs     []string `yaml:"verbs"`
+	Resources []string `yaml:"resources"`
+	APIGroups []string `yaml:"apiGroups"`
+}
+
+func loadPolicy(fileName string) (*Policy, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	policy := &Policy{}
+	if err := yaml.UnmarshalStrict(data, policy); err != nil {
+		return nil, err
+	}
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+		if rule.Name == "" {
+			return nil, fmt.Errorf("Policy rule #%d has no name", i+1)
+		}
+		if rule.Severity == "" {
+			rule.Severity = severityError
+		}
+		if rule.Severity != severityError && rule.Severity != severityWarning && rule.Severity != severityNote {
+			return nil, fmt.Errorf("Policy rule %s has invalid severity %q (expected error, warning or note)", rule.Name, rule.Severity)
+		}
+		for _, kind := range rule.Match.Kinds {
+			switch normalizeKind(kind) {
+			case kindRoleBinding, kindClusterRoleBinding, kindRole, kindClusterRole:
+			default:
+				return nil, fmt.Errorf("Policy rule %s matches unsupported kind %s", rule.Name, kind)
+			}
+		}
+	}
+	return policy, nil
+}
+
+func (p *Policy) checks() []CheckInfo {
+	checks := []CheckInfo{}
+	for _, rule := range p.Rules {
+		checks = append(checks, CheckInfo{id: rule.Name, description: rule.Description})
+	}
+	return checks
+}
+
+// checkPolicy evaluates all policy rules and returns a finding for each violation
+func (r *Rback) checkPolicy(policy *Policy) []Finding {
+	findings := []Finding{}
+	for _, rule := range policy.Rules {
+		for _, bindings := range r.permissions.RoleBindings {
+			for _, binding := range bindings {
+				if r.namespaceSelected(binding.namespace) && rule.Match.matches(bindingRef(binding)) {
+					findings = append(findings, r.checkBinding(rule, binding)...)
+				}
+			}
+		}
+		for _, roles := range r.permissions.Roles {
+			for _, role := range roles {
+				ref := roleRef(role.NamespacedName)
+				if r.policyMatchesRole(rule, role.NamespacedName) {
+					for _, violation := range rule.Forbid.violatingRules(role.rules) {
+						findings = append(findings, rule.newFinding(ref, fmt.Sprintf("grants %q", violation.toHumanReadableString())))
+					}
+				}
+			}
+		}
+	}
+	sortFindings(findings)
+	return findings
+}
+
+func (r *Rback) checkBinding(rule PolicyRule, binding Binding) []Finding {
+	findings := []Finding{}
+	ref := bindingRef(binding)
+	for _, subject := range binding.subjects {
+		for _, pattern := range rule.Forbid.Subjects {
+			if pattern.matches(subject) {
+				findings = append(findings, rule.newFinding(ref, fmt.Sprintf("binds %v", subject)))
+				break
+			}
+		}
+	}
+	boundRole := roleRef(binding.role)
+	for _, pattern := range rule.Forbid.Roles {
+		if pattern.matches(boundRole) {
+			findings = append(findings, rule.newFinding(ref, fmt.Sprintf("refers to %v", boundRole)))
+			break
+		}
+	}
+	// the violating rules of a matched role are reported for the role only, not again for each binding referring to it
+	if roles, found := r.permissions.Roles[binding.role.namespace]; found && !r.policyMatchesRole(rule, binding.role) {
+		if role, found := roles[binding.role.name]; found {
+			for _, violation := range rule.Forbid.violatingRules(role.rules) {
+				findings = append(findings, rule.newFinding(ref, fmt.Sprintf("grants %q through %v", violation.toHumanReadableString(), boundRole)))
+			}
+		}
+	}
+	return findings
+}
+
+// policyMatchesRole returns true if the policy rule is evaluated against the role itself
+func (r *Rback) policyMatchesRole(rule PolicyRule, role NamespacedName) bool {
+	return r.namespaceSelected(role.namespace) && rule.Match.matches(roleRef(role))
+}
+
+func (rule PolicyRule) newFinding(object KindNamespacedName, message string) Finding {
+	return Finding{
+		ruleID:      rule.Name,
+		description: rule.Description,
+		severity:    rule.Severity,
+		message:     message,
+		object:      object,
+	}
+}
+
+func (m PolicyMatch) matches(object KindNamespacedName) bool {
+	if len(m.Kinds) > 0 && !containsKind(m.Kinds, object.kind) {
+		return false
+	}
+	if len(m.Namespaces) > 0 && !matchesAnyGlob(m.Namespaces, object.namespace) {
+		return false
+	}
+	if len(m.Names) > 0 && !matchesAnyGlob(m.Names, object.name) {
+		return false
+	}
+	return !matchesAnyGlob(m.Except, object.name)
+}
+
+func (p SubjectPattern) matches(subject KindNamespacedName) bool {
+	return (p.Kind == "" || normalizeKind(p.Kind) == normalizeKind(subject.kind)) &&
+		(p.Namespace == "" || matchesGlob(p.Namespace, subject.namespace)) &&
+		(p.Name == "" || matchesGlob(p.Name, subject.name))
+}
+
+func (p RolePattern) matches(role KindNamespacedName) bool {
+	return (p.Kind == "" || normalizeKind(p.Kind) == normalizeKind(role.kind)) &&
+		(p.Name == "" || matchesGlob(p.Name, role.name))
+}
+
+func (f PolicyForbid) violatingRules(rules []Rule) []Rule {
+	violations := []Rule{}
+	for _, rule := range rules {
+		for _, pattern := range f.Rules {
+			if pattern.matches(rule) {
+				violations = append(violations, rule)
+				break
+			}
+		}
+	}
+	return violations
+}
+
+func (p RulePattern) matches(rule Rule) bool {
+	return coversAny(rule.verbs, p.Verbs) &&
+		coversAny(rule.resources, p.Resources) &&
+		coversAny(rule.apiGroups, p.APIGroups)
+}
+
+// coversAny returns true if no values are required or if the granted values contain (or wildcard) any of them
+func coversAny(granted []string, required []string) bool {
+	if len(required) == 0 {
+		return true
+	}
+	for _, value := range required {
+		if contains(granted, "*") || contains(granted, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsKind(kinds []string, kind string) bool {
+	for _, k := range kinds {
+		if normalizeKind(k) == normalizeKind(kind) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAnyGlob(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if matchesGlob(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesGlob(pattern, value string) bool {
+	matched, err := path.Match(pattern, value)
+	return err == nil && matched
+}
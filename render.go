@@ -8,7 +8,15 @@ import (
 )
 
 func (r *Rback) genGraph() *dot.Graph {
-	g := newGraph()
+	switch r.config.view {
+	case viewSubjects:
+		return r.genSubjectsGraph()
+	case viewRoles:
+		return r.genRolesGraph()
+	}
+
+	t := r.config.theme
+	g := newGraph(t)
 	r.renderLegend(g)
 
 	for _, bindings := range r.permissions.RoleBindings {
@@ -17,49 +25,84 @@ func (r *Rback) genGraph() *dot.Graph {
 				continue
 			}
 
-			gns := newNamespaceSubgraph(g, binding.namespace)
+			gns := newNamespaceSubgraph(g, t, binding.namespace)
 
 			bindingNode := r.newBindingNode(gns, binding)
 			roleNode := r.newRoleAndRulesNodePair(gns, binding.namespace, binding.role)
 
-			newBindingToRoleEdge(bindingNode, roleNode)
+			r.annotateWithHits(newBindingToRoleEdge(t, bindingNode, roleNode), r.bindingHits(binding.NamespacedName))
 
 			saNodes := []dot.Node{}
+			renderedSubjects := []KindNamespacedName{}
 			for _, subject := range binding.subjects {
-				renderSubject := (r.config.resourceKind != kindServiceAccount) ||
-					(r.namespaceSelected(subject.namespace) && r.resourceNameSelected(subject.name))
-
-				if renderSubject {
-					gns := newNamespaceSubgraph(g, subject.namespace)
+				if r.shouldRenderSubject(subject) {
+					gns := newNamespaceSubgraph(g, t, subject.namespace)
 					subjectNode := r.newSubjectNode(gns, subject.kind, subject.namespace, subject.name)
 					saNodes = append(saNodes, subjectNode)
+					renderedSubjects = append(renderedSubjects, subject)
 				}
 			}
 
-			for _, saNode := range saNodes {
-				newSubjectToBindingEdge(saNode, bindingNode)
+			for i, saNode := range saNodes {
+				r.annotateWithHits(newSubjectToBindingEdge(t, saNode, bindingNode), r.subjectBindingHits(renderedSubjects[i], binding.NamespacedName))
 			}
 		}
 	}
 
-	// draw any additional ServiceAccounts that weren't referenced by bindings (and thus drawn in the code above)
-	if r.config.resourceKind == "" || r.config.resourceKind == kindServiceAccount {
-		for ns, sas := range r.permissions.ServiceAccounts {
+	// draw any additional ServiceAccounts and Roles that weren't referenced by bindings (and thus drawn in the code above)
+	for _, sa := range r.selectedServiceAccounts() {
+		r.newSubjectNode(newNamespaceSubgraph(g, t, sa.namespace), sa.kind, sa.namespace, sa.name)
+	}
+	for _, role := range r.selectedRoles() {
+		r.newRoleAndRulesNodePair(newNamespaceSubgraph(g, t, role.namespace), "", role)
+	}
+
+	if r.depthLimited() {
+		r.renderFocusedResources(g)
+	}
+
+	return g
+}
+
+// selectedServiceAccounts returns the selected ServiceAccounts, whether they're referenced by bindings or not. This
+// includes missing ServiceAccounts that workloads run as.
+func (r *Rback) selectedServiceAccounts() []KindNamespacedName {
+	result := []KindNamespacedName{}
+	if r.config.resourceKind != "" && r.config.resourceKind != kindServiceAccount {
+		return result
+	}
+	for ns, sas := range r.permissions.ServiceAccounts {
+		if !r.namespaceSelected(ns) {
+			continue
+		}
+		for sa, _ := range sas {
+			renderSA := r.config.resourceKind == "" || (r.namespaceSelected(ns) && r.resourceNameSelected(sa))
+			subject := KindNamespacedName{"ServiceAccount", NamespacedName{ns, sa}}
+			if renderSA && r.selectorMatches(subject) {
+				result = append(result, subject)
+			}
+		}
+	}
+	if r.config.showWorkloads {
+		for ns, workloads := range r.permissions.Workloads {
 			if !r.namespaceSelected(ns) {
 				continue
 			}
-			gns := newNamespaceSubgraph(g, ns)
-
-			for sa, _ := range sas {
-				renderSA := r.config.resourceKind == "" || (r.namespaceSelected(ns) && r.resourceNameSelected(sa))
-				if renderSA {
-					r.newSubjectNode(gns, "ServiceAccount", ns, sa)
+			for _, workload := range workloads {
+				renderSA := r.config.resourceKind == "" || r.resourceNameSelected(workload.serviceAccount)
+				subject := KindNamespacedName{"ServiceAccount", NamespacedName{ns, workload.serviceAccount}}
+				if renderSA && !r.subjectExists("ServiceAccount", ns, workload.serviceAccount) && r.selectorMatches(subject) {
+					result = append(result, subject)
 				}
 			}
 		}
 	}
+	return result
+}
 
-	// draw any additional Roles that weren't referenced by bindings (and thus already drawn)
+// selectedRoles returns the selected Roles and ClusterRoles, whether they're referenced by bindings or not
+func (r *Rback) selectedRoles() []NamespacedName {
+	result := []NamespacedName{}
 	for ns, roles := range r.permissions.Roles {
 		var renderRoles bool
 
@@ -74,62 +117,99 @@ func (r *Rback) genGraph() *dot.Graph {
 			continue
 		}
 
-		gns := newNamespaceSubgraph(g, ns)
 		for roleName, _ := range roles {
-			renderRole := r.namespaceSelected(ns) && r.resourceNameSelected(roleName)
+			renderRole := r.namespaceSelected(ns) && r.resourceNameSelected(roleName) && r.selectorMatches(roleRef(NamespacedName{ns, roleName}))
 			if renderRole {
-				r.newRoleAndRulesNodePair(gns, "", NamespacedName{ns, roleName})
+				result = append(result, NamespacedName{ns, roleName})
 			}
 		}
 	}
+	return result
+}
 
-	return g
+// depthLimited returns true if the graph shows the neighborhood of the focused resources up to a configured depth
+func (r *Rback) depthLimited() bool {
+	return r.config.depth >= 0 && r.config.resourceKind != ""
+}
+
+// renderFocusedResources draws the focused resources even if they're not referenced by any binding within the neighborhood
+// (e.g. when the depth is 0)
+func (r *Rback) renderFocusedResources(g *dot.Graph) {
+	t := r.config.theme
+	n := r.neighborhood()
+	for _, subject := range n.subjects {
+		r.newSubjectNode(newNamespaceSubgraph(g, t, subject.namespace), subject.kind, subject.namespace, subject.name)
+	}
+	for _, role := range n.roles {
+		r.newRoleAndRulesNodePair(newNamespaceSubgraph(g, t, role.namespace), "", role)
+	}
+	for _, binding := range n.focusedBindings {
+		r.newBindingNode(newNamespaceSubgraph(g, t, binding.namespace), binding)
+	}
 }
 
 func (r *Rback) renderLegend(g *dot.Graph) {
 	if !r.config.showLegend {
 		return
 	}
+	t := r.config.theme
 
 	legend := g.Subgraph("LEGEND", dot.ClusterOption{})
 
-	namespace := newNamespaceSubgraph(legend, "Namespace")
+	namespace := newNamespaceSubgraph(legend, t, "Namespace")
 
-	sa := newSubjectNode0(namespace, "Kind", "Subject", true, false)
-	missingSa := newSubjectNode0(namespace, "Kind", "Missing Subject", false, false)
+	sa := newSubjectNode0(namespace, t, "Kind", "Subject", true, false)
+	missingSa := newSubjectNode0(namespace, t, "Kind", "Missing Subject", false, false)
 
-	role := newRoleNode(namespace, "ns", "Role", true, false)
-	clusterRoleBoundLocally := newClusterRoleNode(namespace, "ns", "ClusterRole", true, false) // bound by (namespaced!) RoleBinding
-	clusterrole := newClusterRoleNode(legend, "", "ClusterRole", true, false)
+	if r.config.showWorkloads && r.hasWorkloads() {
+		workload := newWorkloadNode0(namespace, t, "Kind", "ns", "Workload", true, false)
+		newWorkloadToSubjectEdge(t, workload, sa)
+	}
+
+	role := newRoleNode(namespace, t, "ns", "Role", true, false)
+	clusterRoleBoundLocally := newClusterRoleNode(namespace, t, "ns", "ClusterRole", true, false) // bound by (namespaced!) RoleBinding
+	clusterrole := newClusterRoleNode(legend, t, "", "ClusterRole", true, false)
 
-	roleBinding := newRoleBindingNode(namespace, "RoleBinding", false)
-	newSubjectToBindingEdge(sa, roleBinding)
-	newSubjectToBindingEdge(missingSa, roleBinding)
-	newBindingToRoleEdge(roleBinding, role)
+	roleBinding := newRoleBindingNode(namespace, t, "RoleBinding", false)
+	newSubjectToBindingEdge(t, sa, roleBinding)
+	newSubjectToBindingEdge(t, missingSa, roleBinding)
+	newBindingToRoleEdge(t, roleBinding, role)
 
-	roleBinding2 := newRoleBindingNode(namespace, "RoleBinding-to-ClusterRole", false)
+	roleBinding2 := newRoleBindingNode(namespace, t, "RoleBinding-to-ClusterRole", false)
 	roleBinding2.Attr("label", "RoleBinding")
-	newSubjectToBindingEdge(sa, roleBinding2)
-	newBindingToRoleEdge(roleBinding2, clusterRoleBoundLocally)
+	newSubjectToBindingEdge(t, sa, roleBinding2)
+	newBindingToRoleEdge(t, roleBinding2, clusterRoleBoundLocally)
 
-	clusterRoleBinding := newClusterRoleBindingNode(legend, "ClusterRoleBinding", false)
-	newSubjectToBindingEdge(sa, clusterRoleBinding)
-	newBindingToRoleEdge(clusterRoleBinding, clusterrole)
+	clusterRoleBinding := newClusterRoleBindingNode(legend, t, "ClusterRoleBinding", false)
+	newSubjectToBindingEdge(t, sa, clusterRoleBinding)
+	newBindingToRoleEdge(t, clusterRoleBinding, clusterrole)
 
 	if r.config.showRules {
-		nsrules := newRulesNode0(namespace, "ns", "Role", "Namespace-scoped\naccess rules", false)
-		newRoleToRulesEdge(role, nsrules)
+		nsrules := newRulesNode0(namespace, t, "ns", "Role", "Namespace-scoped\naccess rules", false)
+		newRoleToRulesEdge(t, role, nsrules)
 
-		nsrules2 := newRulesNode0(namespace, "ns", "ClusterRole", "Namespace-scoped access rules From ClusterRole", false)
+		nsrules2 := newRulesNode0(namespace, t, "ns", "ClusterRole", "Namespace-scoped access rules From ClusterRole", false)
 		nsrules2.Attr("label", "Namespace-scoped\naccess rules")
-		newRoleToRulesEdge(clusterRoleBoundLocally, nsrules2)
+		newRoleToRulesEdge(t, clusterRoleBoundLocally, nsrules2)
+
+		clusterrules := newRulesNode0(legend, t, "", "ClusterRole", "Cluster-scoped\naccess rules", false)
+		newRoleToRulesEdge(t, clusterrole, clusterrules)
+	}
 
-		clusterrules := newRulesNode0(legend, "", "ClusterRole", "Cluster-scoped\naccess rules", false)
-		newRoleToRulesEdge(clusterrole, clusterrules)
+	if r.config.colorBy == colorByRisk {
+		r.renderRiskLegend(legend)
+	} else if _, ok := parseMetadataKey(r.config.colorBy); ok {
+		r.renderMetadataLegend(legend)
 	}
 }
 
 func (r *Rback) shouldRenderBinding(binding Binding) bool {
+	if !r.selectorMatches(bindingRef(binding)) {
+		return false
+	}
+	if r.depthLimited() {
+		return r.neighborhood().bindings[binding.NamespacedName]
+	}
 	switch r.config.resourceKind {
 	case "":
 		return r.namespaceSelected(binding.namespace)
@@ -176,25 +256,43 @@ func (r *Rback) shouldRenderBinding(binding Binding) bool {
 	return false
 }
 
+// shouldRenderSubject returns true if the subject of a rendered binding should be rendered, too
+func (r *Rback) shouldRenderSubject(subject KindNamespacedName) bool {
+	return (r.config.resourceKind != kindServiceAccount) || r.depthLimited() ||
+		(r.namespaceSelected(subject.namespace) && r.resourceNameSelected(subject.name))
+}
+
 func (r *Rback) newBindingNode(gns *dot.Graph, binding Binding) dot.Node {
+	gns = r.groupSubgraph(gns, binding.namespace, bindingRef(binding))
+	var node dot.Node
 	if binding.namespace == "" {
-		return newClusterRoleBindingNode(gns, binding.name, r.isFocused(kindClusterRoleBinding, "", binding.name))
+		node = newClusterRoleBindingNode(gns, r.config.theme, binding.name, r.isFocused(kindClusterRoleBinding, "", binding.name))
 	} else {
-		return newRoleBindingNode(gns, binding.name, r.isFocused(kindRoleBinding, binding.namespace, binding.name))
+		node = newRoleBindingNode(gns, r.config.theme, binding.name, r.isFocused(kindRoleBinding, binding.namespace, binding.name))
 	}
+	r.applyMetadataColor(node, bindingRef(binding))
+	r.applyLink(node, bindingRef(binding))
+	return node
 }
 
 func (r *Rback) newRoleAndRulesNodePair(gns *dot.Graph, bindingNamespace string, role NamespacedName) dot.Node {
+	gns = r.groupSubgraph(gns, iff(bindingNamespace != "", bindingNamespace, role.namespace), roleRef(role))
 	var roleNode dot.Node
 	if role.namespace == "" {
-		roleNode = newClusterRoleNode(gns, bindingNamespace, role.name, r.roleExists(role), r.isFocused(kindClusterRole, role.namespace, role.name))
+		roleNode = newClusterRoleNode(gns, r.config.theme, bindingNamespace, role.name, r.roleExists(role), r.isFocused(kindClusterRole, role.namespace, role.name))
 	} else {
-		roleNode = newRoleNode(gns, role.namespace, role.name, r.roleExists(role), r.isFocused(kindRole, role.namespace, role.name))
+		roleNode = newRoleNode(gns, r.config.theme, role.namespace, role.name, r.roleExists(role), r.isFocused(kindRole, role.namespace, role.name))
+	}
+	if r.config.colorBy == colorByRisk && r.roleExists(role) {
+		applyRiskColor(r.config.theme, roleNode, r.risk().roles[role])
 	}
+	r.applyMetadataColor(roleNode, roleRef(role))
+	r.applyLink(roleNode, roleRef(role))
 	if r.config.showRules {
 		rulesNode := r.newRulesNode(gns, role.namespace, role.name, r.isFocused(kindRule, role.namespace, role.name))
 		if rulesNode != nil {
-			newRoleToRulesEdge(roleNode, *rulesNode)
+			r.applyLink(*rulesNode, roleRef(role))
+			r.annotateWithHits(newRoleToRulesEdge(r.config.theme, roleNode, *rulesNode), r.roleHits(role))
 		}
 	}
 	return roleNode
@@ -210,7 +308,18 @@ func (r *Rback) roleExists(role NamespacedName) bool {
 }
 
 func (r *Rback) newSubjectNode(gns *dot.Graph, kind string, ns string, name string) dot.Node {
-	return newSubjectNode0(gns, kind, name, r.subjectExists(kind, ns, name), r.isFocused(strings.ToLower(kind), ns, name))
+	subject := KindNamespacedName{kind, NamespacedName{ns, name}}
+	exists := r.subjectExists(kind, ns, name)
+	node := newSubjectNode0(r.groupSubgraph(gns, ns, subject), r.config.theme, kind, name, exists, r.isFocused(strings.ToLower(kind), ns, name))
+	if r.config.colorBy == colorByRisk && exists {
+		applyRiskColor(r.config.theme, node, r.risk().subjects[subject])
+	}
+	r.applyMetadataColor(node, subject)
+	r.applyLink(node, subject)
+	if kind == "ServiceAccount" && r.config.showWorkloads {
+		r.newWorkloadNodes(gns, node, ns, name)
+	}
+	return node
 }
 
 func (r *Rback) subjectExists(kind string, ns string, name string) bool {
@@ -265,7 +374,7 @@ func (r *Rback) newRulesNode(g *dot.Graph, namespace, roleName string, highlight
 	if roles, found := r.permissions.Roles[namespace]; found {
 		if role, found := roles[roleName]; found {
 			ellipsis := regularLine("...")
-			for _, rule := range role.rules {
+			for i, rule := range r.renderedRules(role) {
 				ruleMatches := r.config.resourceKind == kindRule && highlight && r.config.whoCan.matches(rule)
 				if ruleMatches {
 					rulesText += boldLine(rule.toHumanReadableString())
@@ -275,7 +384,7 @@ func (r *Rback) newRulesNode(g *dot.Graph, namespace, roleName string, highlight
 							rulesText += ellipsis
 						}
 					} else {
-						rulesText += regularLine(rule.toHumanReadableString())
+						rulesText += r.ruleLine(role.NamespacedName, i, rule)
 					}
 				}
 			}
@@ -284,11 +393,34 @@ func (r *Rback) newRulesNode(g *dot.Graph, namespace, roleName string, highlight
 	if rulesText == "" {
 		return nil
 	} else {
-		node := newRulesNode0(g, namespace, roleName, rulesText, highlight)
+		node := newRulesNode0(g, r.config.theme, namespace, roleName, rulesText, highlight)
 		return &node
 	}
 }
 
+// ruleLine renders a rule with the number of logged requests it allowed or, if it allowed none, faded
+func (r *Rback) ruleLine(role NamespacedName, ruleIndex int, rule Rule) string {
+	if r.auditLog == nil {
+		return regularLine(rule.toHumanReadableString())
+	}
+	if hits := r.ruleHits(role, ruleIndex); hits > 0 {
+		return regularLine(fmt.Sprintf("%s  [%d]", rule.toHumanReadableString(), hits))
+	}
+	return fadedLine(r.config.theme, rule.toHumanReadableString())
+}
+
+// annotateWithHits labels an edge with the number of logged requests that passed through it or, if there were none, fades it
+func (r *Rback) annotateWithHits(edge dot.Edge, hits int) {
+	if r.auditLog == nil {
+		return
+	}
+	if hits > 0 {
+		edge.Attr("label", fmt.Sprintf("%d", hits))
+	} else {
+		r.config.theme.styleEdge(edge, r.config.theme.UnusedEdge)
+	}
+}
+
 func (r *Rule) toHumanReadableString() string {
 	result := strings.Join(r.verbs, ",")
 	if len(r.resources) > 0 {
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+const (
+	formatText  = "text"
+	formatSARIF = "sarif"
+	formatJUnit = "junit"
+)
+
+// CheckInfo describes a check (e.g. a policy rule) that produces findings
+type CheckInfo struct {
+	id          string
+	description string
+}
+
+// writeFindings writes the findings of the given checks in the configured format
+func (r *Rback) writeFindings(w io.Writer, checks []CheckInfo, findings []Finding) error {
+	switch r.config.findingsFormat {
+	case formatText, "":
+		printFindings(w, findings, r.permissions.Sources)
+		return nil
+	case formatSARIF:
+		return writeSARIF(w, checks, findings, r.permissions.Sources)
+	case formatJUnit:
+		return writeJUnit(w, checks, findings, r.permissions.Sources)
+	default:
+		return fmt.Errorf("Unknown format %s (expected text, sarif or junit)", r.config.findingsFormat)
+	}
+}
+
+func (p SourcePosition) String() string {
+	if p.file == "" {
+		return fmt.Sprintf("line %d", p.line)
+	}
+	return fmt.Sprintf("%s:%d", p.file, p.line)
+}
+
+// SARIF 2.1.0, see https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+func writeSARIF(w io.Writer, checks []CheckInfo, findings []Finding, sources map[KindNamespacedName]SourcePosition) error {
+	rules := []sarifRule{}
+	for _, check := range checks {
+		rules = append(rules, sarifRule{ID: check.id, ShortDescription: sarifMessage{iff(check.description == "", check.id, check.description)}})
+	}
+
+	results := []sarifResult{}
+	for _, f := range findings {
+		location := sarifLocation{
+			LogicalLocations: []sarifLogicalLocation{{FullyQualifiedName: f.object.String(), Kind: "object"}},
+		}
+		// GitHub code scanning can only annotate files, so the physical location is omitted for input from stdin
+		if pos, found := sources[f.object]; found && pos.file != "" {
+			location.PhysicalLocation = &sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(pos.file)},
+				Region:           sarifRegion{StartLine: pos.line, StartColumn: pos.column},
+			}
+		}
+		results = append(results, sarifResult{
+			RuleID:    f.ruleID,
+			Level:     f.severity,
+			Message:   sarifMessage{fmt.Sprintf("%v %s", f.object, f.message)},
+			Locations: []sarifLocation{location},
+		})
+	}
+
+	log := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "rback",
+				InformationURI: "https://github.com/team-soteria/rback",
+				Rules:          rules,
+			}},
+			Results: results,
+		}},
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(log)
+}
+
+// JUnit XML as understood by Jenkins: one test suite per check, one failed test case per finding
+// and a single passed test case for checks without findings
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func writeJUnit(w io.Writer, checks []CheckInfo, findings []Finding, sources map[KindNamespacedName]SourcePosition) error {
+	suites := junitTestSuites{}
+	for _, check := range checks {
+		suite := junitTestSuite{Name: check.id}
+		for _, f := range findings {
+			if f.ruleID != check.id {
+				continue
+			}
+			text := check.description
+			if pos, found := sources[f.object]; found {
+				text += fmt.Sprintf("\n%v defined at %v", f.object, pos)
+			}
+			suite.TestCases = append(suite.TestCases, junitTestCase{
+				ClassName: "rback." + check.id,
+				Name:      f.object.String(),
+				Failure:   &junitFailure{Message: f.message, Type: f.severity, Text: text},
+			})
+			suite.Failures++
+		}
+		if len(suite.TestCases) == 0 {
+			suite.TestCases = append(suite.TestCases, junitTestCase{ClassName: "rback." + check.id, Name: check.id})
+		}
+		suite.Tests = len(suite.TestCases)
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
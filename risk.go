@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/emicklei/dot"
+)
+
+const (
+	maxRiskScore          = 100
+	clusterScopeRiskScale = 2 // ClusterRoles bound by ClusterRoleBindings grant access in all namespaces
+	mediumRiskScore       = 20
+	highRiskScore         = 50
+)
+
+var verbRiskWeights = map[string]int{
+	"get":              1,
+	"list":             1,
+	"watch":            1,
+	"create":           3,
+	"update":           3,
+	"patch":            3,
+	"delete":           3,
+	"deletecollection": 3,
+	"*":                5,
+	"bind":             10,
+	"escalate":         10,
+	"impersonate":      10,
+}
+
+// sensitiveResources are resources which allow reading credentials, running code or escalating privileges
+var sensitiveResources = map[string]bool{
+	"secrets":                             true,
+	"pods":                                true,
+	"pods/exec":                           true,
+	"pods/attach":                         true,
+	"pods/portforward":                    true,
+	"serviceaccounts/token":               true,
+	"nodes/proxy":                         true,
+	"roles":                               true,
+	"rolebindings":                        true,
+	"clusterroles":                        true,
+	"clusterrolebindings":                 true,
+	"certificatesigningrequests/approval": true,
+	"mutatingwebhookconfigurations":       true,
+	"validatingwebhookconfigurations":     true,
+}
+
+// RiskScores holds the risk scores of all roles and of all subjects (propagated to them through their bindings)
+type RiskScores struct {
+	roles           map[NamespacedName]int
+	subjects        map[KindNamespacedName]int
+	riskiestBinding map[KindNamespacedName]Binding
+}
+
+// risk returns the risk scores, computing them on first use
+func (r *Rback) risk() *RiskScores {
+	if r.riskScores == nil {
+		r.riskScores = r.computeRiskScores()
+	}
+	return r.riskScores
+}
+
+func (r *Rback) computeRiskScores() *RiskScores {
+	scores := &RiskScores{
+		roles:           map[NamespacedName]int{},
+		subjects:        map[KindNamespacedName]int{},
+		riskiestBinding: map[KindNamespacedName]Binding{},
+	}
+	for _, roles := range r.permissions.Roles {
+		for _, role := range roles {
+			scores.roles[role.NamespacedName] = roleRiskScore(role)
+		}
+	}
+	for _, bindings := range r.permissions.RoleBindings {
+		for _, binding := range bindings {
+			score := scores.bindingScore(binding)
+			for _, subject := range binding.subjects {
+				if existing, found := scores.subjects[subject]; !found || score > existing {
+					scores.subjects[subject] = score
+					scores.riskiestBinding[subject] = binding
+				}
+			}
+		}
+	}
+	return scores
+}
+
+// bindingScore is the score of the bound role, scaled up if the binding grants access cluster-wide
+func (s *RiskScores) bindingScore(binding Binding) int {
+	score := s.roles[binding.role]
+	if binding.namespace == "" {
+		score *= clusterScopeRiskScale
+	}
+	return capRiskScore(score)
+}
+
+func roleRiskScore(role Role) int {
+	score := 0
+	for _, rule := range role.rules {
+		score += ruleRiskScore(rule)
+	}
+	return capRiskScore(score)
+}
+
+// ruleRiskScore multiplies the weight of the riskiest verb by the weight of the most sensitive resource in the rule
+func ruleRiskScore(rule Rule) int {
+	verbWeight := 0
+	for _, verb := range rule.verbs {
+		weight, found := verbRiskWeights[verb]
+		if !found {
+			weight = 2
+		}
+		if weight > verbWeight {
+			verbWeight = weight
+		}
+	}
+
+	resourceWeight := 1
+	for _, resource := range rule.resources {
+		if resource == "*" {
+			resourceWeight = 8
+		} else if sensitiveResources[resource] && resourceWeight < 3 {
+			resourceWeight = 3
+		}
+	}
+	if contains(rule.apiGroups, "*") || contains(rule.nonResourceURLs, "*") {
+		resourceWeight++
+	}
+	return verbWeight * resourceWeight
+}
+
+func capRiskScore(score int) int {
+	if score > maxRiskScore {
+		return maxRiskScore
+	}
+	return score
+}
+
+// applyRiskColor overrides the fill color of a subject or role node with the color of its risk score
+func applyRiskColor(t *Theme, node dot.Node, score int) {
+	node.Attr("fillcolor", t.riskColor(score)).
+		Attr("fontcolor", t.Risk.FontColor)
+}
+
+func (r *Rback) renderRiskLegend(legend *dot.Graph) {
+	for _, level := range []struct {
+		label string
+		score int
+	}{{"Low risk", 0}, {"Medium risk", mediumRiskScore}, {"High risk", highRiskScore}} {
+		node := legend.Node("risk-"+level.label).Box().Attr("label", fmt.Sprintf("%s\n(score >= %d)", level.label, level.score)).Attr("style", "filled").
+			Attr("tooltip", fmt.Sprintf("risk score %d", level.score))
+		applyRiskColor(r.config.theme, node, level.score)
+	}
+}
+
+// printRiskReport prints all subjects and roles in the selected namespaces, riskiest first
+func (r *Rback) printRiskReport(w io.Writer) {
+	scores := r.risk()
+
+	subjects := []KindNamespacedName{}
+	for subject := range scores.subjects {
+		if r.namespaceSelected(scores.riskiestBinding[subject].namespace) || r.namespaceSelected(subject.namespace) {
+			subjects = append(subjects, subject)
+		}
+	}
+	sort.Slice(subjects, func(i, j int) bool {
+		a, b := subjects[i], subjects[j]
+		if scores.subjects[a] != scores.subjects[b] {
+			return scores.subjects[a] > scores.subjects[b]
+		}
+		return a.String() < b.String()
+	})
+
+	roles := []NamespacedName{}
+	for role := range scores.roles {
+		if r.namespaceSelected(role.namespace) {
+			roles = append(roles, role)
+		}
+	}
+	sort.Slice(roles, func(i, j int) bool {
+		a, b := roles[i], roles[j]
+		if scores.roles[a] != scores.roles[b] {
+			return scores.roles[a] > scores.roles[b]
+		}
+		return roleRef(a).String() < roleRef(b).String()
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "SCORE\tSUBJECT\tRISKIEST BINDING\n")
+	for _, subject := range subjects {
+		binding := scores.riskiestBinding[subject]
+		fmt.Fprintf(tw, "%d\t%v\t%v -> %v\n", scores.subjects[subject], subject, bindingRef(binding), roleRef(binding.role))
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+
+	tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "SCORE\tROLE\tRISKIEST RULE\n")
+	for _, role := range roles {
+		fmt.Fprintf(tw, "%d\t%v\t%s\n", scores.roles[role], roleRef(role), r.riskiestRule(role))
+	}
+	tw.Flush()
+}
+
+func (r *Rback) riskiestRule(roleName NamespacedName) string {
+	role := r.permissions.Roles[roleName.namespace][roleName.name]
+	riskiest := ""
+	maxScore := -1
+	for _, rule := range role.rules {
+		if score := ruleRiskScore(rule); score > maxScore {
+			maxScore = score
+			riskiest = rule.toHumanReadableString()
+		}
+	}
+	return riskiest
+}
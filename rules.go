@@ -0,0 +1,29 @@
+package main
+
+// grants returns true if the rule allows the given verb on the given resource in the given API group, taking wildcards
+// into account. An empty resource matches any resource (but not non-resource URLs) and an empty apiGroup matches any API group.
+func (r *Rule) grants(verb, resource, apiGroup string) bool {
+	return (contains(r.verbs, "*") || contains(r.verbs, verb)) &&
+		(resource == "" && len(r.resources) > 0 || contains(r.resources, "*") || contains(r.resources, resource)) &&
+		(apiGroup == "" || contains(r.apiGroups, "*") || contains(r.apiGroups, apiGroup))
+}
+
+// grantsAny returns true if the rule allows any of the given verbs on the given resource
+func (r *Rule) grantsAny(verbs []string, resource, apiGroup string) bool {
+	for _, verb := range verbs {
+		if r.grants(verb, resource, apiGroup) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasWildcard returns true if the rule uses "*" in its verbs, resources or API groups
+func (r *Rule) hasWildcard() bool {
+	return contains(r.verbs, "*") || contains(r.resources, "*") || contains(r.apiGroups, "*")
+}
+
+// allows returns true if the rule allows the observed usage, including usage of the core API group
+func (r *Rule) allows(u APIUsage) bool {
+	return r.grants(u.verb, u.resource, u.apiGroup) && (contains(r.apiGroups, "*") || contains(r.apiGroups, u.apiGroup))
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// operators of label selector requirements
+const (
+	selectorEquals       = "="
+	selectorNotEquals    = "!="
+	selectorIn           = "in"
+	selectorNotIn        = "notin"
+	selectorExists       = "exists"
+	selectorDoesNotExist = "!"
+)
+
+// LabelSelector is a Kubernetes label selector (e.g. "team=payments,env!=dev,tier in (web,api),!legacy"). All
+// requirements must match, and an empty selector matches everything.
+type LabelSelector []SelectorRequirement
+
+// SelectorRequirement is a single requirement of a label selector
+type SelectorRequirement struct {
+	key      string
+	operator string
+	values   []string
+}
+
+// parseLabelSelector parses the equality-based (=, ==, !=) and set-based (in, notin, exists, !) requirements of a
+// label selector. Like kubectl, it rejects empty requirements (e.g. "team=payments,").
+func parseLabelSelector(selector string) (LabelSelector, error) {
+	requirements := LabelSelector{}
+	if strings.TrimSpace(selector) == "" {
+		return requirements, nil
+	}
+	for _, part := range splitSelector(selector) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("Invalid label selector %q: empty requirement", selector)
+		}
+		requirement, err := parseSelectorRequirement(part)
+		if err != nil {
+			return nil, err
+		}
+		requirements = append(requirements, requirement)
+	}
+	return requirements, nil
+}
+
+// splitSelector splits a selector at the commas separating its requirements, i.e. at the commas outside of parentheses
+func splitSelector(selector string) []string {
+	parts := []string{}
+	depth, start := 0, 0
+	for i, c := range selector {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, selector[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, selector[start:])
+}
+
+func parseSelectorRequirement(part string) (SelectorRequirement, error) {
+	if strings.HasPrefix(part, "!") {
+		key := strings.TrimSpace(part[1:])
+		if !validLabelKey(key) {
+			return SelectorRequirement{}, fmt.Errorf("Invalid label selector requirement %q", part)
+		}
+		return SelectorRequirement{key: key, operator: selectorDoesNotExist}, nil
+	}
+	if i := strings.Index(part, "!="); i >= 0 {
+		return newSelectorRequirement(part, part[:i], selectorNotEquals, part[i+2:])
+	}
+	if i := strings.Index(part, "=="); i >= 0 {
+		return newSelectorRequirement(part, part[:i], selectorEquals, part[i+2:])
+	}
+	if i := strings.Index(part, "="); i >= 0 {
+		return newSelectorRequirement(part, part[:i], selectorEquals, part[i+1:])
+	}
+	if fields := strings.Fields(part); len(fields) == 1 && validLabelKey(fields[0]) {
+		return SelectorRequirement{key: fields[0], operator: selectorExists}, nil
+	}
+	// the set may follow the operator without a space, e.g. "tier notin(db)"
+	if i := strings.Index(part, "("); i >= 0 && strings.HasSuffix(part, ")") {
+		fields := strings.Fields(part[:i])
+		if len(fields) == 2 && validLabelKey(fields[0]) && (fields[1] == selectorIn || fields[1] == selectorNotIn) {
+			values := []string{}
+			for _, value := range strings.Split(part[i+1:len(part)-1], ",") {
+				if value = strings.TrimSpace(value); strings.ContainsAny(value, " ()!=") {
+					return SelectorRequirement{}, fmt.Errorf("Invalid label selector requirement %q", part)
+				} else if value != "" {
+					values = append(values, value)
+				}
+			}
+			if len(values) > 0 {
+				return SelectorRequirement{key: fields[0], operator: fields[1], values: values}, nil
+			}
+		}
+	}
+	return SelectorRequirement{}, fmt.Errorf("Invalid label selector requirement %q", part)
+}
+
+func newSelectorRequirement(part, key, operator, value string) (SelectorRequirement, error) {
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+	if !validLabelKey(key) || strings.ContainsAny(value, " ()!=") {
+		return SelectorRequirement{}, fmt.Errorf("Invalid label selector requirement %q", part)
+	}
+	return SelectorRequirement{key: key, operator: operator, values: []string{value}}, nil
+}
+
+func validLabelKey(key string) bool {
+	return key != "" && !strings.ContainsAny(key, " (),!=")
+}
+
+// matches returns true if the labels meet all requirements of the selector
+func (s LabelSelector) matches(labels map[string]string) bool {
+	for _, requirement := range s {
+		if !requirement.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func (requirement SelectorRequirement) matches(labels map[string]string) bool {
+	value, found := labels[requirement.key]
+	switch requirement.operator {
+	case selectorEquals, selectorIn:
+		return found && contains(requirement.values, value)
+	case selectorNotEquals, selectorNotIn:
+		return !found || !contains(requirement.values, value)
+	case selectorExists:
+		return found
+	case selectorDoesNotExist:
+		return !found
+	}
+	return false
+}
+
+// selectorMatches returns true if the object matches the label selector given with --selector. Users and Groups have
+// no labels, so they only match an empty selector or one that requires labels not to exist or to differ.
+func (r *Rback) selectorMatches(object KindNamespacedName) bool {
+	if len(r.config.selector) == 0 {
+		return true
+	}
+	return r.config.selector.matches(r.permissions.Metadata[object].labels)
+}
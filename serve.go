@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// kubectlResources are the kinds fetched from the cluster (the same as in the kubectl plugin)
+const kubectlResources = "sa,roles,rolebindings,clusterroles,clusterrolebindings,pods,deployments,statefulsets,daemonsets,jobs,cronjobs"
+
+// Server serves graphs and queries computed from the RBAC resources loaded last. Each request works on its own Rback
+// (with the configuration adjusted by the query parameters), sharing the loaded resources, which are only modified
+// while no request is handled.
+type Server struct {
+	config      Config
+	mutex       sync.RWMutex
+	permissions Permissions
+	auditLog    *AuditLog
+	generation  int
+}
+
+// AccessGrant is an access rule granted to a subject by a binding, in the binding's namespace ("" for cluster-wide)
+type AccessGrant struct {
+	Subject   string   `json:"subject"`
+	Binding   string   `json:"binding"`
+	Role      string   `json:"role"`
+	Namespace string   `json:"namespace,omitempty"`
+	Rules     []string `json:"rules"`
+}
+
+// runServe loads the input, starts reloading or watching it (if configured) and serves HTTP requests until the server
+// fails. It returns the process exit code.
+func runServe(config Config) int {
+	s := &Server{config: config}
+	input, err := readInput(config)
+	if err == nil {
+		err = s.load(input)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can't load RBAC resources: %v\n", err)
+		return -1
+	}
+	if config.reloadInterval > 0 {
+		go s.reloadPeriodically(config.reloadInterval)
+	}
+	if config.watch {
+		watcher, err := newWatcher(config, input)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Can't watch RBAC resources: %v\n", err)
+			return -1
+		}
+		go func() {
+			if err := watcher.watch(s.applyChanges); err != nil {
+				log.Printf("Can't watch RBAC resources: %v", err)
+			}
+		}()
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.locked(s.handleHTML))
+	mux.HandleFunc("/graph.dot", s.locked(s.handleDot))
+	mux.HandleFunc("/graph.json", s.locked(s.handleJSON))
+	mux.HandleFunc("/who-can", s.locked(s.handleWhoCan))
+	mux.HandleFunc("/what-can", s.locked(s.handleWhatCan))
+	mux.HandleFunc("/generation", s.locked(s.handleGeneration))
+
+	log.Printf("Serving RBAC graphs on %s", config.addr)
+	if err := http.ListenAndServe(config.addr, mux); err != nil {
+		fmt.Fprintf(os.Stderr, "Can't serve on %s: %v\n", config.addr, err)
+		return -1
+	}
+	return 0
+}
+
+// load parses the RBAC resources and replaces the served ones
+func (s *Server) load(input []byte) error {
+	r := Rback{config: s.config}
+	if err := r.parseRBAC(bytes.NewReader(input)); err != nil {
+		return err
+	}
+	var err error
+	if len(s.config.auditLogFiles) > 0 {
+		if r.auditLog, err = loadAuditLogs(s.config.auditLogFiles); err != nil {
+			return err
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.permissions, s.auditLog = r.permissions, r.auditLog
+	s.generation++
+	return nil
+}
+
+// applyChanges applies the changes reported by a watcher to the served resources
+func (s *Server) applyChanges(changes []ObjectChange) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	r := Rback{config: s.config, permissions: s.permissions}
+	r.applyChanges(changes)
+	s.permissions = r.permissions
+	s.generation++
+	log.Printf("Applied %d changed object(s)", len(changes))
+}
+
+// readInput reads the RBAC resources from the cluster (with kubectl), the input file or stdin
+func readInput(config Config) ([]byte, error) {
+	if config.fromCluster {
+		return readFromCluster()
+	}
+	if config.inputFile != "" {
+		return ioutil.ReadFile(config.inputFile)
+	}
+	return ioutil.ReadAll(os.Stdin)
+}
+
+// readFromCluster fetches the RBAC resources and workloads of all namespaces with kubectl
+func readFromCluster() ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("kubectl", "get", kubectlResources, "--all-namespaces", "-o", "json")
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("kubectl failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// reloadPeriodically reloads the input in the given interval, keeping the previously loaded resources on errors
+func (s *Server) reloadPeriodically(interval time.Duration) {
+	for range time.Tick(interval) {
+		input, err := readInput(s.config)
+		if err == nil {
+			err = s.load(input)
+		}
+		if err != nil {
+			log.Printf("Can't reload RBAC resources: %v", err)
+		}
+	}
+}
+
+// locked wraps a handler, so that the served resources can't change while it's handling a request. The response is
+// buffered and only written after unlocking, so that slow clients don't block reloads.
+func (s *Server) locked(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		response := newBufferedResponse()
+		s.mutex.RLock()
+		handler(response, req)
+		s.mutex.RUnlock()
+		response.writeTo(w)
+	}
+}
+
+// bufferedResponse is a ResponseWriter keeping the status, headers and body in memory
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) Write(data []byte) (int, error) {
+	return b.body.Write(data)
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	b.status = status
+}
+
+// writeTo writes the buffered response to w
+func (b *bufferedResponse) writeTo(w http.ResponseWriter) {
+	for key, values := range b.header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(b.status)
+	if _, err := b.body.WriteTo(w); err != nil {
+		log.Printf("Can't write response: %v", err)
+	}
+}
+
+// handleGeneration returns the number of times the served resources were loaded or changed. The HTML report polls
+// it to reload itself when the resources change.
+func (s *Server) handleGeneration(w http.ResponseWriter, req *http.Request) {
+	fmt.Fprintln(w, s.generation)
+}
+
+// newRback returns an Rback working on the loaded resources, with the configuration adjusted by the query parameters
+// n, kind, name, depth, view, rules, compact-rules, color-by, group-by and selector (which work like the command line flags
+// and arguments)
+func (s *Server) newRback(query url.Values) (*Rback, error) {
+	config := s.config
+	if namespaces := query.Get("n"); namespaces != "" {
+		config.namespaces = strings.Split(namespaces, ",")
+	}
+	if kind := query.Get("kind"); kind != "" {
+		config.resourceKind = normalizeKind(kind)
+		config.resourceNames = nil
+		if names := query.Get("name"); names != "" {
+			config.resourceNames = strings.Split(names, ",")
+		}
+	}
+	if depth := query.Get("depth"); depth != "" {
+		var err error
+		if config.depth, err = strconv.Atoi(depth); err != nil {
+			return nil, fmt.Errorf("Invalid depth %q", depth)
+		}
+	}
+	if view := query.Get("view"); view != "" {
+		if !validView(view) {
+			return nil, fmt.Errorf("Unknown view %s (expected full, subjects or roles)", view)
+		}
+		config.view = view
+	}
+	if rules := query.Get("rules"); rules != "" {
+		config.showRules = rules == "true"
+	}
+	if compactRules := query.Get("compact-rules"); compactRules != "" {
+		config.compactRules = compactRules == "true"
+	}
+	if colorBy := query.Get("color-by"); colorBy != "" {
+		if !validColorBy(colorBy) {
+			return nil, fmt.Errorf("Unknown color-by %s (expected risk, label=KEY or annotation=KEY)", colorBy)
+		}
+		config.colorBy = colorBy
+	}
+	if groupBy := query.Get("group-by"); groupBy != "" {
+		if !validGroupBy(groupBy) {
+			return nil, fmt.Errorf("Unknown group-by %s (expected label=KEY or annotation=KEY)", groupBy)
+		}
+		config.groupBy = groupBy
+	}
+	if selector := query.Get("selector"); selector != "" {
+		var err error
+		if config.selector, err = parseLabelSelector(selector); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Rback{config: config, permissions: s.permissions, auditLog: s.auditLog}, nil
+}
+
+func (s *Server) handleHTML(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/" {
+		http.NotFound(w, req)
+		return
+	}
+	r, err := s.newRback(req.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := r.writeLiveHTML(w, s.config.watch || s.config.reloadInterval > 0); err != nil {
+		log.Printf("Can't write HTML report: %v", err)
+	}
+}
+
+func (s *Server) handleDot(w http.ResponseWriter, req *http.Request) {
+	r, err := s.newRback(req.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+	fmt.Fprintln(w, r.genGraph().String())
+}
+
+func (s *Server) handleJSON(w http.ResponseWriter, req *http.Request) {
+	r, err := s.newRback(req.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := r.writeJSON(w); err != nil {
+		log.Printf("Can't write JSON response: %v", err)
+	}
+}
+
+// handleWhoCan lists the subjects granted the verb on the resource (and optionally the named object), given by the
+// query parameters verb, resource and name
+func (s *Server) handleWhoCan(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	if query.Get("verb") == "" || query.Get("resource") == "" {
+		http.Error(w, "Usage: /who-can?verb=VERB&resource=RESOURCE[&name=NAME]", http.StatusBadRequest)
+		return
+	}
+	r, err := s.newRback(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.config.resourceKind = kindRule
+	r.config.whoCan = WhoCan{verb: query.Get("verb"), resourceKind: query.Get("resource"), resourceName: query.Get("name")}
+	writeJSON(w, r.whoCanGrants())
+}
+
+// handleWhatCan lists the access rules granted to the subject given by the query parameters kind, namespace (for
+// ServiceAccounts) and name
+func (s *Server) handleWhatCan(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	subject, err := toSubject(query.Get("kind"), query.Get("namespace"), query.Get("name"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r, err := s.newRback(url.Values{"n": query["n"]})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, r.whatCanGrants(subject))
+}
+
+// toSubject converts the kind (e.g. "sa"), namespace and name given in a query to a subject
+func toSubject(kind, namespace, name string) (KindNamespacedName, error) {
+	if name == "" {
+		return KindNamespacedName{}, fmt.Errorf("Usage: /what-can?kind=sa|user|group[&namespace=NAMESPACE]&name=NAME")
+	}
+	switch normalizeKind(kind) {
+	case kindServiceAccount:
+		return KindNamespacedName{"ServiceAccount", NamespacedName{namespace, name}}, nil
+	case kindUser:
+		return KindNamespacedName{"User", NamespacedName{"", name}}, nil
+	case kindGroup:
+		return KindNamespacedName{"Group", NamespacedName{"", name}}, nil
+	}
+	return KindNamespacedName{}, fmt.Errorf("Unknown subject kind %q (expected sa, user or group)", kind)
+}
+
+// whoCanGrants returns the matching rules granted to the subjects of all bindings selected by the who-can query
+func (r *Rback) whoCanGrants() []AccessGrant {
+	grants := []AccessGrant{}
+	subjects, bindingsBySubject := r.selectedSubjects()
+	for _, subject := range subjects {
+		for _, binding := range bindingsBySubject[subject] {
+			rules := []string{}
+			for _, rule := range r.permissions.Roles[binding.role.namespace][binding.role.name].rules {
+				if r.config.whoCan.matches(rule) {
+					rules = append(rules, rule.toHumanReadableString())
+				}
+			}
+			grants = append(grants, newAccessGrant(subject, binding, rules))
+		}
+	}
+	sortAccessGrants(grants)
+	return grants
+}
+
+// whatCanGrants returns the rules granted to the subject by all bindings in the selected namespaces. ServiceAccounts
+// are also granted the rules bound to the groups they implicitly belong to.
+func (r *Rback) whatCanGrants(subject KindNamespacedName) []AccessGrant {
+	var bindings []Binding
+	if subject.kind == "ServiceAccount" {
+		bindings = r.bindingsOf(subject)
+	} else {
+		for _, nsBindings := range r.permissions.RoleBindings {
+			for _, binding := range nsBindings {
+				if bindsSubject(binding, subject, nil) {
+					bindings = append(bindings, binding)
+				}
+			}
+		}
+	}
+
+	grants := []AccessGrant{}
+	for _, binding := range bindings {
+		if !r.namespaceSelected(binding.namespace) {
+			continue
+		}
+		rules := []string{}
+		for _, rule := range r.permissions.Roles[binding.role.namespace][binding.role.name].rules {
+			rules = append(rules, rule.toHumanReadableString())
+		}
+		grants = append(grants, newAccessGrant(subject, binding, rules))
+	}
+	sortAccessGrants(grants)
+	return grants
+}
+
+func newAccessGrant(subject KindNamespacedName, binding Binding, rules []string) AccessGrant {
+	return AccessGrant{
+		Subject:   subject.String(),
+		Binding:   bindingRef(binding).String(),
+		Role:      roleRef(binding.role).String(),
+		Namespace: binding.namespace,
+		Rules:     rules,
+	}
+}
+
+func sortAccessGrants(grants []AccessGrant) {
+	sort.Slice(grants, func(i, j int) bool {
+		if grants[i].Subject != grants[j].Subject {
+			return grants[i].Subject < grants[j].Subject
+		}
+		return grants[i].Binding < grants[j].Binding
+	})
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		log.Printf("Can't write JSON response: %v", err)
+	}
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// sizes of the SVG layout in pixels. Text widths are estimated from the number of characters, as the SVG is rendered
+// without access to the font.
+const (
+	svgFontSize        = 12
+	svgCharWidth       = 7.0
+	svgLineHeight      = 15.0
+	svgNodePadding     = 10.0
+	svgNodeGap         = 20.0
+	svgRankGap         = 50.0
+	svgClusterPadding  = 10.0
+	svgClusterLabel    = 18.0
+	svgMargin          = 10.0
+	svgOrderingSweeps  = 4
+	svgOctagonCorner   = 10.0
+	svgNoteFold        = 8.0
+	svgDoubleLineInset = 3.0
+)
+
+// SVGBox is the position and size of a node or cluster
+type SVGBox struct {
+	x, y, w, h float64
+}
+
+// SVGLayout is a layered layout of a diagram: each rank (workloads, subjects, bindings, roles, rules) is a row, and each
+// cluster (namespace) takes up a column of its own, so that cluster boxes never overlap. Left-to-right diagrams are laid
+// out the same way with the axes swapped, i.e. ranks become columns and clusters rows.
+type SVGLayout struct {
+	diagram   *Diagram
+	theme     *Theme
+	rows      map[*DiagramCluster]map[int][]*DiagramNode
+	neighbors map[*DiagramNode][]*DiagramNode
+	rankTops  map[int]float64
+	rankSizes map[int]float64
+	nodes     map[*DiagramNode]*SVGBox
+	clusters  map[*DiagramCluster]*SVGBox
+}
+
+// writeSVG lays out the diagram and writes it as SVG, so that images can be created without Graphviz
+func (r *Rback) writeSVG(w io.Writer) error {
+	d := r.genDiagram()
+	d.assignIDs()
+	l := newSVGLayout(d)
+	l.layout()
+
+	var out bytes.Buffer
+	l.write(&out)
+	_, err := out.WriteTo(w)
+	return err
+}
+
+func newSVGLayout(d *Diagram) *SVGLayout {
+	l := &SVGLayout{
+		diagram:   d,
+		theme:     d.theme,
+		rows:      map[*DiagramCluster]map[int][]*DiagramNode{},
+		neighbors: map[*DiagramNode][]*DiagramNode{},
+		rankTops:  map[int]float64{},
+		rankSizes: map[int]float64{},
+		nodes:     map[*DiagramNode]*SVGBox{},
+		clusters:  map[*DiagramCluster]*SVGBox{},
+	}
+	for _, edge := range d.edges {
+		l.neighbors[edge.from] = append(l.neighbors[edge.from], edge.to)
+		l.neighbors[edge.to] = append(l.neighbors[edge.to], edge.from)
+	}
+	return l
+}
+
+// layout sizes the nodes, stacks the ranks and orders the nodes within each row by the barycenter of their neighbors
+func (l *SVGLayout) layout() {
+	l.addRows(l.diagram.root)
+
+	ranks := []int{}
+	for rank := range l.rankSizes {
+		ranks = append(ranks, rank)
+	}
+	sort.Ints(ranks)
+	top := 0.0
+	for _, rank := range ranks {
+		l.rankTops[rank] = top
+		top += l.rankSizes[rank] + svgRankGap
+	}
+
+	l.place(l.diagram.root, 0)
+	for i := 0; i < svgOrderingSweeps; i++ {
+		for _, row := range l.allRows() {
+			barycenters := map[*DiagramNode]float64{}
+			for _, node := range row {
+				barycenters[node] = l.barycenter(node)
+			}
+			sort.SliceStable(row, func(i, j int) bool { return barycenters[row[i]] < barycenters[row[j]] })
+		}
+		l.place(l.diagram.root, 0)
+	}
+
+	if l.theme.leftToRight() {
+		for _, box := range l.nodes {
+			box.transpose()
+		}
+		for _, box := range l.clusters {
+			box.transpose()
+		}
+	}
+}
+
+// addRows sorts the nodes of a cluster (and its nested clusters) into rows by rank
+func (l *SVGLayout) addRows(c *DiagramCluster) {
+	l.rows[c] = map[int][]*DiagramNode{}
+	for _, node := range c.sortedNodes() {
+		l.rows[c][node.rank] = append(l.rows[c][node.rank], node)
+		box := svgNodeSize(node)
+		if l.theme.leftToRight() {
+			box.transpose()
+		}
+		l.nodes[node] = &box
+		l.rankSizes[node.rank] = math.Max(l.rankSizes[node.rank], box.h)
+	}
+	for _, cluster := range c.sortedClusters() {
+		l.addRows(cluster)
+	}
+}
+
+func (l *SVGLayout) allRows() [][]*DiagramNode {
+	rows := [][]*DiagramNode{}
+	for _, byRank := range l.rows {
+		for _, row := range byRank {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// barycenter returns the average horizontal center of the node's neighbors, or the node's own center if it has none
+func (l *SVGLayout) barycenter(node *DiagramNode) float64 {
+	if len(l.neighbors[node]) == 0 {
+		return l.nodes[node].x + l.nodes[node].w/2
+	}
+	sum := 0.0
+	for _, neighbor := range l.neighbors[node] {
+		sum += l.nodes[neighbor].x + l.nodes[neighbor].w/2
+	}
+	return sum / float64(len(l.neighbors[node]))
+}
+
+// place positions the cluster's own nodes (centering each row) and then its nested clusters side by side, starting at
+// left, and returns the width of the cluster. The cluster label is above the nodes, which is beside them while the axes
+// are swapped.
+func (l *SVGLayout) place(c *DiagramCluster, left float64) float64 {
+	padding, labelBeside, labelAbove := svgClusterPadding, 0.0, svgClusterLabel
+	if c.parent == nil {
+		padding, labelAbove = 0, 0
+	} else if l.theme.leftToRight() {
+		labelBeside, labelAbove = svgClusterLabel, 0
+	}
+	start := left + padding + labelBeside
+	x := start
+
+	ownWidth := 0.0
+	for _, row := range l.rows[c] {
+		ownWidth = math.Max(ownWidth, l.rowWidth(row))
+	}
+	for rank, row := range l.rows[c] {
+		nodeX := x + (ownWidth-l.rowWidth(row))/2
+		for _, node := range row {
+			box := l.nodes[node]
+			box.x, box.y = nodeX, l.rankTops[rank]+(l.rankSizes[rank]-box.h)/2
+			nodeX += box.w + svgNodeGap
+		}
+	}
+	if ownWidth > 0 {
+		x += ownWidth + svgNodeGap
+	}
+	for _, cluster := range c.sortedClusters() {
+		x += l.place(cluster, x) + svgNodeGap
+	}
+	if x > start {
+		x -= svgNodeGap
+	}
+	width := x + padding - left
+
+	if c.parent != nil {
+		top, bottom := math.Inf(1), math.Inf(-1)
+		for _, row := range l.rows[c] {
+			for _, node := range row {
+				top, bottom = math.Min(top, l.nodes[node].y), math.Max(bottom, l.nodes[node].y+l.nodes[node].h)
+			}
+		}
+		for _, cluster := range c.clusters {
+			top, bottom = math.Min(top, l.clusters[cluster].y), math.Max(bottom, l.clusters[cluster].y+l.clusters[cluster].h)
+		}
+		if math.IsInf(top, 1) {
+			top, bottom = 0, 0
+		}
+		l.clusters[c] = &SVGBox{left, top - padding - labelAbove, width, bottom - top + 2*padding + labelAbove}
+	}
+	return width
+}
+
+func (box *SVGBox) transpose() {
+	box.x, box.y, box.w, box.h = box.y, box.x, box.h, box.w
+}
+
+func (l *SVGLayout) rowWidth(row []*DiagramNode) float64 {
+	width := 0.0
+	for _, node := range row {
+		width += l.nodes[node].w
+	}
+	return width + float64(len(row)-1)*svgNodeGap
+}
+
+// bounds returns the box enclosing all nodes and clusters
+func (l *SVGLayout) bounds() SVGBox {
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	boxes := []*SVGBox{}
+	for _, box := range l.nodes {
+		boxes = append(boxes, box)
+	}
+	for _, box := range l.clusters {
+		boxes = append(boxes, box)
+	}
+	for _, box := range boxes {
+		minX, minY = math.Min(minX, box.x), math.Min(minY, box.y)
+		maxX, maxY = math.Max(maxX, box.x+box.w), math.Max(maxY, box.y+box.h)
+	}
+	if len(boxes) == 0 {
+		return SVGBox{}
+	}
+	return SVGBox{minX, minY, maxX - minX, maxY - minY}
+}
+
+func (l *SVGLayout) write(out *bytes.Buffer) {
+	t := l.theme
+	bounds := l.bounds()
+	width, height := bounds.w+2*svgMargin, bounds.h+2*svgMargin
+	fontFamily := "Helvetica,Arial,sans-serif"
+	if t.FontName != "" {
+		fontFamily = t.FontName + "," + fontFamily
+	}
+	fmt.Fprintf(out, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f" font-family="%s" font-size="%d" fill="%s">`+"\n",
+		width, height, width, height, html.EscapeString(fontFamily), svgFontSize, iff(t.FontColor == "", "black", t.FontColor))
+	out.WriteString(`<defs>`)
+	for _, marker := range []struct{ id, color string }{{"arrow", l.edgeColor(false)}, {"arrow-faded", l.edgeColor(true)}} {
+		fmt.Fprintf(out, `<marker id="%s" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto-start-reverse"><path d="M0,0 L10,5 L0,10 z" fill="%s"/></marker>`,
+			marker.id, marker.color)
+	}
+	out.WriteString("</defs>\n")
+	fmt.Fprintf(out, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", iff(t.Background == "", "white", t.Background))
+	fmt.Fprintf(out, `<g transform="translate(%.1f,%.1f)">`+"\n", svgMargin-bounds.x, svgMargin-bounds.y)
+	l.writeClusters(out, l.diagram.root)
+	for _, edge := range l.diagram.edges {
+		l.writeEdge(out, edge)
+	}
+	l.writeNodes(out, l.diagram.root)
+	out.WriteString("</g>\n</svg>\n")
+}
+
+func (l *SVGLayout) writeClusters(out *bytes.Buffer, c *DiagramCluster) {
+	stroke := iff(l.theme.Namespace.Color == "", iff(l.theme.FontColor == "", "black", l.theme.FontColor), l.theme.Namespace.Color)
+	for _, cluster := range c.sortedClusters() {
+		box := l.clusters[cluster]
+		fmt.Fprintf(out, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="none" stroke="%s"%s/>`+"\n",
+			box.x, box.y, box.w, box.h, stroke, iff(cluster.dashed, ` stroke-dasharray="6,4"`, ""))
+		fmt.Fprintf(out, `<text x="%.1f" y="%.1f" text-anchor="middle">%s</text>`+"\n",
+			box.x+box.w/2, box.y+svgClusterLabel-4, html.EscapeString(cluster.label))
+		l.writeClusters(out, cluster)
+	}
+}
+
+// writeEdge draws an edge as a curve from the bottom of the upper node to the top of the lower node or, left to right,
+// from the right side of the left node to the left side of the right node
+func (l *SVGLayout) writeEdge(out *bytes.Buffer, edge *DiagramEdge) {
+	from, to := l.nodes[edge.from], l.nodes[edge.to]
+	x1, y1, x2, y2 := from.x+from.w/2, from.y+from.h, to.x+to.w/2, to.y
+	cx1, cy1, cx2, cy2 := x1, (y1+y2)/2, x2, (y1+y2)/2
+	if l.theme.leftToRight() {
+		x1, y1, x2, y2 = from.x+from.w, from.y+from.h/2, to.x, to.y+to.h/2
+		cx1, cy1, cx2, cy2 = (x1+x2)/2, y1, (x1+x2)/2, y2
+	}
+	marker := iff(edge.faded, "arrow-faded", "arrow")
+	fmt.Fprintf(out, `<path d="M%.1f,%.1f C%.1f,%.1f %.1f,%.1f %.1f,%.1f" fill="none" stroke="%s"%s %s="url(#%s)"/>`+"\n",
+		x1, y1, cx1, cy1, cx2, cy2, x2, y2, l.edgeColor(edge.faded), iff(edge.faded, ` stroke-dasharray="6,4"`, ""),
+		iff(edge.back, "marker-start", "marker-end"), marker)
+	if edge.label != "" {
+		fmt.Fprintf(out, `<text x="%.1f" y="%.1f">%s</text>`+"\n", (x1+x2)/2+4, (y1+y2)/2+4, html.EscapeString(edge.label))
+	}
+}
+
+func (l *SVGLayout) edgeColor(faded bool) string {
+	if faded && l.theme.UnusedEdge.Color != "" {
+		return l.theme.UnusedEdge.Color
+	}
+	return iff(l.theme.Edge.Color == "", "black", l.theme.Edge.Color)
+}
+
+func (l *SVGLayout) writeNodes(out *bytes.Buffer, c *DiagramCluster) {
+	for _, node := range c.sortedNodes() {
+		l.writeNode(out, node)
+	}
+	for _, cluster := range c.sortedClusters() {
+		l.writeNodes(out, cluster)
+	}
+}
+
+// writeNode writes the shape and label of a node, wrapped in a link if the node has a URL
+func (l *SVGLayout) writeNode(out *bytes.Buffer, node *DiagramNode) {
+	if node.url != "" {
+		fmt.Fprintf(out, `<a href="%s" target="_blank">`+"\n", html.EscapeString(node.url))
+		defer fmt.Fprintf(out, "</a>\n")
+	}
+	if node.tooltip != "" {
+		fmt.Fprintf(out, "<g>\n<title>%s</title>\n", html.EscapeString(node.tooltip))
+		defer fmt.Fprintf(out, "</g>\n")
+	}
+	box := l.nodes[node]
+	border := iff(node.border == "", l.edgeColor(false), node.border)
+	stroke := fmt.Sprintf(`stroke="%s" stroke-width="%s"`, border, iff(node.bold, "2", "1"))
+	if node.dotted {
+		stroke += ` stroke-dasharray="2,3"`
+	} else if node.dashed {
+		stroke += ` stroke-dasharray="6,4"`
+	}
+	style := fmt.Sprintf(`fill="%s" %s`, iff(node.fill == "", "white", node.fill), stroke)
+
+	switch node.shape {
+	case diagramShapeComponent:
+		fmt.Fprintf(out, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" %s/>`+"\n", box.x, box.y, box.w, box.h, style)
+		for _, y := range []float64{box.y + box.h*0.25, box.y + box.h*0.75 - 6} {
+			fmt.Fprintf(out, `<rect x="%.1f" y="%.1f" width="8" height="6" %s/>`+"\n", box.x-4, y, style)
+		}
+	case diagramShapeOctagon:
+		fmt.Fprintf(out, `<polygon points="%s" %s/>`+"\n", octagonPoints(*box, 0), style)
+	case diagramShapeDoubleOctagon:
+		fmt.Fprintf(out, `<polygon points="%s" %s/>`+"\n", octagonPoints(*box, 0), style)
+		fmt.Fprintf(out, `<polygon points="%s" %s/>`+"\n", octagonPoints(*box, svgDoubleLineInset), `fill="none" `+stroke)
+	case diagramShapeNote:
+		x, y, w, h := box.x, box.y, box.w, box.h
+		fmt.Fprintf(out, `<polygon points="%.1f,%.1f %.1f,%.1f %.1f,%.1f %.1f,%.1f %.1f,%.1f" %s/>`+"\n",
+			x, y, x+w-svgNoteFold, y, x+w, y+svgNoteFold, x+w, y+h, x, y+h, style)
+		fmt.Fprintf(out, `<polyline points="%.1f,%.1f %.1f,%.1f %.1f,%.1f" fill="none" stroke="%s"/>`+"\n",
+			x+w-svgNoteFold, y, x+w-svgNoteFold, y+svgNoteFold, x+w, y+svgNoteFold, border)
+	default:
+		fmt.Fprintf(out, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" %s/>`+"\n", box.x, box.y, box.w, box.h, style)
+	}
+
+	// access rules are left-aligned, like in the dot output
+	anchor, x := "middle", box.x+box.w/2
+	if node.shape == diagramShapeNote {
+		anchor, x = "start", box.x+svgNodePadding
+	}
+	y := box.y + (box.h-float64(len(node.lines))*svgLineHeight)/2 + svgFontSize
+	for _, line := range node.lines {
+		color := iff(node.fontColor == "", iff(l.theme.FontColor == "", "black", l.theme.FontColor), node.fontColor)
+		if line.faded {
+			color = l.theme.FadedText
+		}
+		fmt.Fprintf(out, `<text x="%.1f" y="%.1f" text-anchor="%s" fill="%s"%s>%s</text>`+"\n",
+			x, y, anchor, color, iff(line.bold, ` font-weight="bold"`, ""), html.EscapeString(line.text))
+		y += svgLineHeight
+	}
+}
+
+// svgNodeSize estimates the size of a node from its label
+func svgNodeSize(node *DiagramNode) SVGBox {
+	width := 0.0
+	for _, line := range node.lines {
+		width = math.Max(width, float64(utf8.RuneCountInString(line.text))*svgCharWidth*iffFloat(line.bold, 1.1, 1))
+	}
+	width += 2 * svgNodePadding
+	switch node.shape {
+	case diagramShapeOctagon, diagramShapeDoubleOctagon:
+		width += 2 * svgOctagonCorner
+	case diagramShapeNote:
+		width += svgNoteFold
+	}
+	return SVGBox{w: math.Max(width, 60), h: float64(len(node.lines))*svgLineHeight + 2*svgNodePadding}
+}
+
+// octagonPoints returns the corners of an octagon filling the box, inset by the given distance
+func octagonPoints(box SVGBox, inset float64) string {
+	x1, y1, x2, y2 := box.x+inset, box.y+inset, box.x+box.w-inset, box.y+box.h-inset
+	c := math.Min(svgOctagonCorner, (y2-y1)/3)
+	points := [][2]float64{{x1 + c, y1}, {x2 - c, y1}, {x2, y1 + c}, {x2, y2 - c}, {x2 - c, y2}, {x1 + c, y2}, {x1, y2 - c}, {x1, y1 + c}}
+	coordinates := []string{}
+	for _, point := range points {
+		coordinates = append(coordinates, fmt.Sprintf("%.1f,%.1f", point[0], point[1]))
+	}
+	return strings.Join(coordinates, " ")
+}
+
+func iffFloat(condition bool, value1, value2 float64) float64 {
+	if condition {
+		return value1
+	}
+	return value2
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/emicklei/dot"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	themeDefault      = "default"
+	themeDark         = "dark"
+	themeHighContrast = "high-contrast"
+	themePrint        = "print"
+)
+
+// Theme holds the colors, shapes and pen widths of all outputs that draw the graph. Attribute values are Graphviz
+// attribute values (e.g. shape: octagon, style: "filled,dashed"); outputs other than dot translate them as well as
+// they can.
+type Theme struct {
+	Base       string       `yaml:"base"` // only used in theme files: the built-in theme the file modifies
+	Background string       `yaml:"background"`
+	FontName   string       `yaml:"fontname"`
+	FontColor  string       `yaml:"fontcolor"` // namespace, legend and edge labels
+	RankDir    string       `yaml:"rankdir"`
+	Namespace  ThemeStyle   `yaml:"namespace"`
+	Group      ThemeStyle   `yaml:"group"` // clusters of nodes grouped by a label or annotation
+	Nodes      ThemeNodes   `yaml:"nodes"`
+	Edge       ThemeStyle   `yaml:"edge"`
+	UnusedEdge ThemeStyle   `yaml:"unusedEdge"` // edges no logged request passed through
+	FadedText  string       `yaml:"fadedText"`  // access rules that allowed no logged request
+	Highlight  ThemeStyle   `yaml:"highlight"`  // applied on top of the node style to focused resources
+	Missing    ThemeStyle   `yaml:"missing"`    // applied on top of the node style to missing resources
+	Risk       ThemeRisk    `yaml:"risk"`
+	Palette    ThemePalette `yaml:"palette"`
+}
+
+// ThemeNodes are the node styles by kind
+type ThemeNodes struct {
+	Subject            ThemeStyle `yaml:"subject"`
+	Workload           ThemeStyle `yaml:"workload"`
+	RoleBinding        ThemeStyle `yaml:"rolebinding"`
+	ClusterRoleBinding ThemeStyle `yaml:"clusterrolebinding"`
+	Role               ThemeStyle `yaml:"role"`
+	ClusterRole        ThemeStyle `yaml:"clusterrole"`
+	Rules              ThemeStyle `yaml:"rules"`
+}
+
+// ThemeStyle are the Graphviz attributes of a node, edge or cluster. Empty attributes aren't set.
+type ThemeStyle struct {
+	Shape     string `yaml:"shape"`
+	Style     string `yaml:"style"`
+	Color     string `yaml:"color"`
+	FillColor string `yaml:"fillcolor"`
+	FontColor string `yaml:"fontcolor"`
+	PenWidth  string `yaml:"penwidth"`
+}
+
+// ThemePalette are the fill colors of nodes when coloring by a label or annotation, assigned to the values in order
+type ThemePalette struct {
+	Colors    []string `yaml:"colors"`
+	FontColor string   `yaml:"fontcolor"`
+}
+
+// ThemeRisk are the fill colors of subjects and roles when coloring by risk
+type ThemeRisk struct {
+	Low       string `yaml:"low"`
+	Medium    string `yaml:"medium"`
+	High      string `yaml:"high"`
+	FontColor string `yaml:"fontcolor"`
+}
+
+var builtinThemes = map[string]Theme{
+	themeDefault: {
+		Namespace: ThemeStyle{Style: "dashed"},
+		Group:     ThemeStyle{Style: "rounded", Color: "#808080"},
+		Nodes: ThemeNodes{
+			Subject:            ThemeStyle{Shape: "box", Style: "filled", Color: "black", FillColor: "#2f6de1", FontColor: "#f0f0f0", PenWidth: "1.0"},
+			Workload:           ThemeStyle{Shape: "component", Style: "filled", FillColor: "#66c2a5", FontColor: "#030303", PenWidth: "1.0"},
+			RoleBinding:        ThemeStyle{Shape: "octagon", Style: "filled", FillColor: "#ffcc00", FontColor: "#030303", PenWidth: "1.0"},
+			ClusterRoleBinding: ThemeStyle{Shape: "doubleoctagon", Style: "filled", FillColor: "#ffcc00", FontColor: "#030303", PenWidth: "1.0"},
+			Role:               ThemeStyle{Shape: "octagon", Style: "filled", Color: "black", FillColor: "#ff9900", FontColor: "#030303", PenWidth: "1.0"},
+			ClusterRole:        ThemeStyle{Shape: "doubleoctagon", Style: "filled", Color: "black", FillColor: "#ff9900", FontColor: "#030303", PenWidth: "1.0"},
+			Rules:              ThemeStyle{Shape: "note", PenWidth: "1.0"},
+		},
+		UnusedEdge: ThemeStyle{Style: "dashed", Color: "#c0c0c0"},
+		FadedText:  "#a0a0a0",
+		Highlight:  ThemeStyle{PenWidth: "2.0"},
+		Missing:    ThemeStyle{Style: "dotted", Color: "red", FontColor: "#030303", PenWidth: "2.0"},
+		Risk:       ThemeRisk{Low: "#b3e6b3", Medium: "#ffcc66", High: "#ff6666", FontColor: "#030303"},
+		Palette:    ThemePalette{Colors: []string{"#8dd3c7", "#ffffb3", "#bebada", "#fb8072", "#80b1d3", "#fdb462", "#b3de69", "#fccde5", "#d9d9d9", "#bc80bd", "#ccebc5", "#ffed6f"}, FontColor: "#030303"},
+	},
+	// for slides with a dark background
+	themeDark: {
+		Background: "#1e1e1e",
+		FontColor:  "#e0e0e0",
+		Namespace:  ThemeStyle{Style: "dashed", Color: "#a0a0a0", FontColor: "#e0e0e0"},
+		Group:      ThemeStyle{Style: "rounded", Color: "#707070", FontColor: "#e0e0e0"},
+		Nodes: ThemeNodes{
+			Subject:            ThemeStyle{Shape: "box", Style: "filled", Color: "#e0e0e0", FillColor: "#3d7bf0", FontColor: "#ffffff", PenWidth: "1.0"},
+			Workload:           ThemeStyle{Shape: "component", Style: "filled", Color: "#e0e0e0", FillColor: "#2e9c7a", FontColor: "#ffffff", PenWidth: "1.0"},
+			RoleBinding:        ThemeStyle{Shape: "octagon", Style: "filled", Color: "#e0e0e0", FillColor: "#e6b800", FontColor: "#1e1e1e", PenWidth: "1.0"},
+			ClusterRoleBinding: ThemeStyle{Shape: "doubleoctagon", Style: "filled", Color: "#e0e0e0", FillColor: "#e6b800", FontColor: "#1e1e1e", PenWidth: "1.0"},
+			Role:               ThemeStyle{Shape: "octagon", Style: "filled", Color: "#e0e0e0", FillColor: "#f08c00", FontColor: "#1e1e1e", PenWidth: "1.0"},
+			ClusterRole:        ThemeStyle{Shape: "doubleoctagon", Style: "filled", Color: "#e0e0e0", FillColor: "#f08c00", FontColor: "#1e1e1e", PenWidth: "1.0"},
+			Rules:              ThemeStyle{Shape: "note", Style: "filled", Color: "#e0e0e0", FillColor: "#2d2d2d", FontColor: "#e0e0e0", PenWidth: "1.0"},
+		},
+		Edge:       ThemeStyle{Color: "#e0e0e0", FontColor: "#e0e0e0"},
+		UnusedEdge: ThemeStyle{Style: "dashed", Color: "#5a5a5a"},
+		FadedText:  "#7a7a7a",
+		Highlight:  ThemeStyle{PenWidth: "3.0"},
+		Missing:    ThemeStyle{Style: "dotted", Color: "#ff6b6b", FontColor: "#ff6b6b", PenWidth: "2.0"},
+		Risk:       ThemeRisk{Low: "#7fbf7f", Medium: "#e6b84d", High: "#e65c5c", FontColor: "#1e1e1e"},
+		Palette:    ThemePalette{Colors: []string{"#66c2a5", "#fc8d62", "#8da0cb", "#e78ac3", "#a6d854", "#ffd92f", "#e5c494", "#b3b3b3"}, FontColor: "#1e1e1e"},
+	},
+	// colorblind-safe (Okabe-Ito) colors, thick lines, and missing resources that differ in line style and fill rather
+	// than in color only
+	themeHighContrast: {
+		Background: "#ffffff",
+		FontColor:  "#000000",
+		Namespace:  ThemeStyle{Style: "dashed,bold", Color: "#000000"},
+		Group:      ThemeStyle{Style: "rounded,bold", Color: "#000000"},
+		Nodes: ThemeNodes{
+			Subject:            ThemeStyle{Shape: "box", Style: "filled", Color: "#000000", FillColor: "#0072b2", FontColor: "#ffffff", PenWidth: "2.0"},
+			Workload:           ThemeStyle{Shape: "component", Style: "filled", Color: "#000000", FillColor: "#009e73", FontColor: "#ffffff", PenWidth: "2.0"},
+			RoleBinding:        ThemeStyle{Shape: "octagon", Style: "filled", Color: "#000000", FillColor: "#f0e442", FontColor: "#000000", PenWidth: "2.0"},
+			ClusterRoleBinding: ThemeStyle{Shape: "doubleoctagon", Style: "filled", Color: "#000000", FillColor: "#f0e442", FontColor: "#000000", PenWidth: "2.0"},
+			Role:               ThemeStyle{Shape: "octagon", Style: "filled", Color: "#000000", FillColor: "#e69f00", FontColor: "#000000", PenWidth: "2.0"},
+			ClusterRole:        ThemeStyle{Shape: "doubleoctagon", Style: "filled", Color: "#000000", FillColor: "#e69f00", FontColor: "#000000", PenWidth: "2.0"},
+			Rules:              ThemeStyle{Shape: "note", Style: "filled", Color: "#000000", FillColor: "#ffffff", FontColor: "#000000", PenWidth: "2.0"},
+		},
+		Edge:       ThemeStyle{Color: "#000000", FontColor: "#000000", PenWidth: "2.0"},
+		UnusedEdge: ThemeStyle{Style: "dotted", Color: "#000000", PenWidth: "1.0"},
+		FadedText:  "#767676",
+		Highlight:  ThemeStyle{PenWidth: "4.0"},
+		Missing:    ThemeStyle{Style: "dashed", Color: "#d55e00", FontColor: "#000000", PenWidth: "4.0"},
+		Risk:       ThemeRisk{Low: "#56b4e9", Medium: "#f0e442", High: "#d55e00", FontColor: "#000000"},
+		Palette:    ThemePalette{Colors: []string{"#e69f00", "#56b4e9", "#009e73", "#f0e442", "#cc79a7", "#d55e00", "#ffffff"}, FontColor: "#000000"},
+	},
+	// greyscale, for printing
+	themePrint: {
+		Background: "#ffffff",
+		FontColor:  "#000000",
+		Namespace:  ThemeStyle{Style: "dashed", Color: "#000000"},
+		Group:      ThemeStyle{Style: "rounded", Color: "#000000"},
+		Nodes: ThemeNodes{
+			Subject:            ThemeStyle{Shape: "box", Style: "filled", Color: "#000000", FillColor: "#d9d9d9", FontColor: "#000000", PenWidth: "1.0"},
+			Workload:           ThemeStyle{Shape: "component", Style: "filled", Color: "#000000", FillColor: "#f2f2f2", FontColor: "#000000", PenWidth: "1.0"},
+			RoleBinding:        ThemeStyle{Shape: "octagon", Style: "filled", Color: "#000000", FillColor: "#ffffff", FontColor: "#000000", PenWidth: "1.0"},
+			ClusterRoleBinding: ThemeStyle{Shape: "doubleoctagon", Style: "filled", Color: "#000000", FillColor: "#ffffff", FontColor: "#000000", PenWidth: "1.0"},
+			Role:               ThemeStyle{Shape: "octagon", Style: "filled", Color: "#000000", FillColor: "#a6a6a6", FontColor: "#000000", PenWidth: "1.0"},
+			ClusterRole:        ThemeStyle{Shape: "doubleoctagon", Style: "filled", Color: "#000000", FillColor: "#a6a6a6", FontColor: "#000000", PenWidth: "1.0"},
+			Rules:              ThemeStyle{Shape: "note", Color: "#000000", FontColor: "#000000", PenWidth: "1.0"},
+		},
+		Edge:       ThemeStyle{Color: "#000000", FontColor: "#000000"},
+		UnusedEdge: ThemeStyle{Style: "dashed", Color: "#a6a6a6"},
+		FadedText:  "#8c8c8c",
+		Highlight:  ThemeStyle{PenWidth: "3.0"},
+		Missing:    ThemeStyle{Style: "dotted", Color: "#000000", FontColor: "#000000", PenWidth: "2.0"},
+		Risk:       ThemeRisk{Low: "#f2f2f2", Medium: "#bfbfbf", High: "#8c8c8c", FontColor: "#000000"},
+		Palette:    ThemePalette{Colors: []string{"#ffffff", "#e6e6e6", "#cccccc", "#b3b3b3", "#999999", "#808080"}, FontColor: "#000000"},
+	},
+}
+
+var themeNames = []string{themeDefault, themeDark, themeHighContrast, themePrint}
+
+// loadTheme returns the built-in theme with the given name or loads a theme file. A theme file only needs to contain
+// the attributes it changes: they're applied to the built-in theme named by its base (or the default theme).
+func loadTheme(name string) (*Theme, error) {
+	if theme, found := builtinThemes[name]; found {
+		return &theme, nil
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var base struct {
+		Base string `yaml:"base"`
+	}
+	if err := yaml.Unmarshal(data, &base); err != nil {
+		return nil, err
+	}
+	if base.Base == "" {
+		base.Base = themeDefault
+	}
+	theme, found := builtinThemes[base.Base]
+	if !found {
+		return nil, fmt.Errorf("Unknown base theme %s (expected %s)", base.Base, strings.Join(themeNames, ", "))
+	}
+	if err := yaml.UnmarshalStrict(data, &theme); err != nil {
+		return nil, err
+	}
+	if theme.RankDir != "" && theme.RankDir != "TB" && theme.RankDir != "LR" {
+		return nil, fmt.Errorf("Invalid rankdir %q (expected TB or LR)", theme.RankDir)
+	}
+	return &theme, nil
+}
+
+// leftToRight returns true if the graph is laid out from left to right instead of from top to bottom
+func (t *Theme) leftToRight() bool {
+	return t.RankDir == "LR"
+}
+
+// styleNode sets the style's attributes and the theme's font on a dot node
+func (t *Theme) styleNode(node dot.Node, s ThemeStyle) dot.Node {
+	setAttr(node.AttributesMap, "shape", s.Shape)
+	setAttr(node.AttributesMap, "style", s.Style)
+	setAttr(node.AttributesMap, "color", s.Color)
+	setAttr(node.AttributesMap, "fillcolor", s.FillColor)
+	setAttr(node.AttributesMap, "fontcolor", s.FontColor)
+	setAttr(node.AttributesMap, "penwidth", s.PenWidth)
+	setAttr(node.AttributesMap, "fontname", t.FontName)
+	return node
+}
+
+// styleEdge sets the style's attributes and the theme's font on a dot edge
+func (t *Theme) styleEdge(edge dot.Edge, s ThemeStyle) dot.Edge {
+	setAttr(edge.AttributesMap, "style", s.Style)
+	setAttr(edge.AttributesMap, "color", s.Color)
+	setAttr(edge.AttributesMap, "fontcolor", s.FontColor)
+	setAttr(edge.AttributesMap, "penwidth", s.PenWidth)
+	setAttr(edge.AttributesMap, "fontname", t.FontName)
+	return edge
+}
+
+// setAttr sets an attribute unless its value is empty (dot.AttributesMap.Attr would set it to "")
+func setAttr(attributes dot.AttributesMap, key, value string) {
+	if value != "" {
+		attributes.Attr(key, value)
+	}
+}
+
+// nodeStyle returns the style of a node of the given kind, with the missing and highlight styles applied on top
+func (t *Theme) nodeStyle(style ThemeStyle, exists, highlight bool) ThemeStyle {
+	if !exists {
+		style = style.merge(t.Missing)
+	}
+	if highlight {
+		style = style.merge(t.Highlight)
+	}
+	return style
+}
+
+// merge returns the style with the attributes set in other replacing its own. The pen width only ever grows, so that
+// a highlighted missing resource isn't drawn thinner than a missing one.
+func (s ThemeStyle) merge(other ThemeStyle) ThemeStyle {
+	penWidth := s.PenWidth
+	if other.PenWidth != "" && penWidthOf(other.PenWidth) > penWidthOf(penWidth) {
+		penWidth = other.PenWidth
+	}
+	return ThemeStyle{
+		Shape:     iff(other.Shape == "", s.Shape, other.Shape),
+		Style:     iff(other.Style == "", s.Style, other.Style),
+		Color:     iff(other.Color == "", s.Color, other.Color),
+		FillColor: iff(other.FillColor == "", s.FillColor, other.FillColor),
+		FontColor: iff(other.FontColor == "", s.FontColor, other.FontColor),
+		PenWidth:  penWidth,
+	}
+}
+
+// withStyle returns the style with an additional Graphviz style (e.g. dashed)
+func (s ThemeStyle) withStyle(style string) ThemeStyle {
+	s.Style = strings.Trim(s.Style+","+style, ",")
+	return s
+}
+
+// hasStyle returns true if the style contains the given Graphviz style (e.g. filled)
+func (s ThemeStyle) hasStyle(style string) bool {
+	return contains(strings.Split(s.Style, ","), style)
+}
+
+func penWidthOf(value string) float64 {
+	width, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 1
+	}
+	return width
+}
+
+// riskColor returns the fill color of a subject or role with the given risk score
+func (t *Theme) riskColor(score int) string {
+	if score >= highRiskScore {
+		return t.Risk.High
+	} else if score >= mediumRiskScore {
+		return t.Risk.Medium
+	}
+	return t.Risk.Low
+}
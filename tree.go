@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// treeGlyphs are the prefixes drawn in front of tree nodes: branch, last branch, continuation and blank
+type treeGlyphs [4]string
+
+var (
+	unicodeTreeGlyphs = treeGlyphs{"├── ", "└── ", "│   ", "    "}
+	asciiTreeGlyphs   = treeGlyphs{"|-- ", "`-- ", "|   ", "    "}
+)
+
+const (
+	ansiBold  = "\x1b[1m"
+	ansiRed   = "\x1b[31m"
+	ansiReset = "\x1b[0m"
+)
+
+// TreeNode is a line of the tree output with the lines nested under it
+type TreeNode struct {
+	label    string
+	focused  bool
+	missing  bool
+	children []*TreeNode
+}
+
+// writeTree prints the selected resources as a tree of namespaces, bindings (with their subjects) and roles (with their
+// access rules). Roles and subjects in the selection that aren't referenced by a selected binding are listed at the
+// end of their namespace. Focused resources are printed bold and missing ones red, if writing to a terminal.
+func (r *Rback) writeTree(w io.Writer, glyphs treeGlyphs) error {
+	color := isTerminal(w)
+	for _, root := range r.genTree() {
+		if _, err := fmt.Fprintln(w, formatTreeLabel(root, color)); err != nil {
+			return err
+		}
+		for i, child := range root.children {
+			if err := writeTreeNode(w, child, "", i == len(root.children)-1, glyphs, color); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// genTree builds one tree per namespace (cluster-wide first) from the graph model
+func (r *Rback) genTree() []*TreeNode {
+	m := r.graphModel()
+	incoming, outgoing := map[string][]*GraphNode{}, map[string][]*GraphNode{}
+	for _, edge := range m.Edges {
+		incoming[edge.To] = append(incoming[edge.To], m.nodes[edge.From])
+		outgoing[edge.From] = append(outgoing[edge.From], m.nodes[edge.To])
+	}
+
+	namespaces := map[string]*TreeNode{}
+	namespaceNode := func(ns string) *TreeNode {
+		if namespaces[ns] == nil {
+			namespaces[ns] = &TreeNode{label: iff(ns == "", "cluster-wide", "namespace "+ns)}
+		}
+		return namespaces[ns]
+	}
+
+	unbound := map[string][]*TreeNode{}
+	for _, node := range m.Nodes {
+		switch node.Type {
+		case nodeTypeBinding:
+			bindingNode := newTreeNode(node)
+			for _, subject := range incoming[node.ID] {
+				bindingNode.children = append(bindingNode.children, newTreeNode(subject))
+			}
+			for _, role := range outgoing[node.ID] {
+				bindingNode.children = append(bindingNode.children, r.newRoleTreeNode(role))
+			}
+			ns := namespaceNode(node.Namespace)
+			ns.children = append(ns.children, bindingNode)
+		case nodeTypeRole:
+			if len(incoming[node.ID]) == 0 {
+				unbound[node.Namespace] = append(unbound[node.Namespace], r.newRoleTreeNode(node))
+			}
+		case nodeTypeSubject:
+			if len(outgoing[node.ID]) == 0 {
+				unbound[node.Namespace] = append(unbound[node.Namespace], newTreeNode(node))
+			}
+		}
+	}
+	for ns, nodes := range unbound {
+		namespaceNode(ns).children = append(namespaceNode(ns).children, &TreeNode{label: "(not bound)", children: nodes})
+	}
+
+	names := []string{}
+	for ns := range namespaces {
+		names = append(names, ns)
+	}
+	sort.Strings(names)
+	roots := []*TreeNode{}
+	for _, ns := range names {
+		roots = append(roots, namespaces[ns])
+	}
+	return roots
+}
+
+func newTreeNode(node *GraphNode) *TreeNode {
+	return &TreeNode{label: node.ID, focused: node.Focused, missing: node.Missing}
+}
+
+// newRoleTreeNode creates the node of a role with its access rules, highlighting (or, if requested, only listing) the
+// rules matching a who-can query
+func (r *Rback) newRoleTreeNode(node *GraphNode) *TreeNode {
+	roleNode := newTreeNode(node)
+	if !r.config.showRules {
+		return roleNode
+	}
+	for _, rule := range r.renderedRules(r.permissions.Roles[node.Namespace][node.Name]) {
+		matches := r.config.resourceKind == kindRule && r.config.whoCan.matches(rule)
+		if r.config.whoCan.showMatchedOnly && r.config.resourceKind == kindRule && !matches {
+			continue
+		}
+		roleNode.children = append(roleNode.children, &TreeNode{label: rule.toHumanReadableString(), focused: matches})
+	}
+	return roleNode
+}
+
+func writeTreeNode(w io.Writer, node *TreeNode, prefix string, last bool, glyphs treeGlyphs, color bool) error {
+	branch, continuation := glyphs[0], glyphs[2]
+	if last {
+		branch, continuation = glyphs[1], glyphs[3]
+	}
+	if _, err := fmt.Fprintln(w, prefix+branch+formatTreeLabel(node, color)); err != nil {
+		return err
+	}
+	for i, child := range node.children {
+		if err := writeTreeNode(w, child, prefix+continuation, i == len(node.children)-1, glyphs, color); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatTreeLabel(node *TreeNode, color bool) string {
+	label := node.label
+	if node.missing {
+		label += " (missing)"
+	}
+	if !color {
+		return label
+	}
+	style := ""
+	if node.focused {
+		style += ansiBold
+	}
+	if node.missing {
+		style += ansiRed
+	}
+	if style == "" {
+		return label
+	}
+	return style + label + ansiReset
+}
+
+// isTerminal returns true if w is a terminal (and the user didn't opt out of colors by setting NO_COLOR)
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
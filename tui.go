@@ -0,0 +1,615 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	paneNamespaces = iota
+	paneSubjects
+	paneBindings
+	paneRoles
+	paneCount
+)
+
+const tuiExportFile = "rback-focus.dot"
+
+var paneTitles = []string{"Namespaces", "Subjects", "Bindings", "Roles"}
+
+// tuiKindTags are the short kind names shown in front of items (the same as accepted on the command line)
+var tuiKindTags = map[string]string{
+	kindServiceAccount:     "sa",
+	kindUser:               "u",
+	kindGroup:              "g",
+	kindRoleBinding:        "rb",
+	kindClusterRoleBinding: "crb",
+	kindRole:               "r",
+	kindClusterRole:        "cr",
+}
+
+// TUIState is what the terminal UI shows: the resources in a namespace ("" for all), optionally focused on a single
+// resource or on the subjects matching a who-can query, just like the corresponding command line arguments
+type TUIState struct {
+	namespace string
+	focus     KindNamespacedName // kind is one of the kind constants, e.g. kindServiceAccount
+	whoCan    *WhoCan
+}
+
+// TUIItem is an entry in one of the panes
+type TUIItem struct {
+	label   string
+	kind    string // one of the kind constants, empty for namespaces
+	ref     NamespacedName
+	focused bool
+	missing bool
+}
+
+// TUI is a full-screen terminal browser over the parsed resources
+type TUI struct {
+	base      *Rback
+	state     TUIState
+	history   []TUIState
+	pane      int
+	selection [paneCount]int
+	offset    [paneCount]int
+	items     [paneCount][]TUIItem
+	prompt    *string // the who-can query being typed, if any
+	status    string
+}
+
+// runTUI runs the terminal UI until the user quits and returns the process exit code
+func (r *Rback) runTUI() int {
+	restore, err := rawTerminal()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can't switch the terminal to raw mode: %v\n", err)
+		return -1
+	}
+	fmt.Print("\x1b[?1049h\x1b[?25l") // alternate screen, hidden cursor
+	defer func() {
+		fmt.Print("\x1b[?25h\x1b[?1049l")
+		restore()
+	}()
+
+	t := &TUI{base: r, state: TUIState{namespace: tuiNamespace(r.config.namespaces)}}
+	t.update()
+	buf := make([]byte, 32)
+	for {
+		rows, cols := terminalSize()
+		var screen bytes.Buffer
+		t.render(&screen, rows, cols)
+		os.Stdout.Write(screen.Bytes())
+
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return 0
+		}
+		for _, key := range splitKeys(string(buf[:n])) {
+			if !t.handleKey(key) {
+				return 0
+			}
+		}
+	}
+}
+
+func tuiNamespace(namespaces []string) string {
+	if len(namespaces) == 1 {
+		return namespaces[0]
+	}
+	return ""
+}
+
+// rback returns an Rback with the configuration corresponding to the current state
+func (t *TUI) rback() *Rback {
+	config := t.base.config
+	config.namespaces = []string{t.state.namespace}
+	config.resourceKind, config.resourceNames, config.depth = "", nil, -1
+	if t.state.whoCan != nil {
+		config.resourceKind = kindRule
+		config.whoCan = *t.state.whoCan
+	} else if t.state.focus.kind != "" {
+		config.resourceKind = t.state.focus.kind
+		config.resourceNames = []string{t.state.focus.name}
+		if t.state.focus.namespace != "" {
+			config.namespaces = []string{t.state.focus.namespace}
+		}
+	}
+	return &Rback{config: config, permissions: t.base.permissions, auditLog: t.base.auditLog}
+}
+
+// update recomputes the items of all panes from the current state
+func (t *TUI) update() {
+	r := t.rback()
+
+	t.items[paneNamespaces] = []TUIItem{{label: "(all namespaces)", focused: t.state.namespace == ""}}
+	for _, ns := range t.namespaces() {
+		t.items[paneNamespaces] = append(t.items[paneNamespaces], TUIItem{label: ns, ref: NamespacedName{ns, ""}, focused: ns == t.state.namespace})
+	}
+
+	bindings := []Binding{}
+	for _, nsBindings := range r.permissions.RoleBindings {
+		for _, binding := range nsBindings {
+			if r.shouldRenderBinding(binding) {
+				bindings = append(bindings, binding)
+			}
+		}
+	}
+	sort.Slice(bindings, func(i, j int) bool { return bindingRef(bindings[i]).String() < bindingRef(bindings[j]).String() })
+
+	subjects, _ := r.selectedSubjects()
+	subjects = append(subjects, r.selectedServiceAccounts()...)
+	t.items[paneSubjects] = []TUIItem{}
+	seen := map[string]bool{}
+	for _, subject := range subjects {
+		if !seen[subject.String()] {
+			seen[subject.String()] = true
+			kind := strings.ToLower(subject.kind)
+			t.items[paneSubjects] = append(t.items[paneSubjects], TUIItem{
+				label:   subject.String(),
+				kind:    kind,
+				ref:     subject.NamespacedName,
+				focused: r.isFocused(kind, subject.namespace, subject.name),
+				missing: !r.subjectExists(subject.kind, subject.namespace, subject.name),
+			})
+		}
+	}
+	sortTUIItems(t.items[paneSubjects])
+
+	t.items[paneBindings] = []TUIItem{}
+	roles := []NamespacedName{}
+	for _, binding := range bindings {
+		ref := bindingRef(binding)
+		kind := strings.ToLower(ref.kind)
+		t.items[paneBindings] = append(t.items[paneBindings], TUIItem{
+			label:   ref.String(),
+			kind:    kind,
+			ref:     binding.NamespacedName,
+			focused: r.isFocused(kind, binding.namespace, binding.name),
+		})
+		roles = append(roles, binding.role)
+	}
+
+	t.items[paneRoles] = []TUIItem{}
+	seen = map[string]bool{}
+	for _, role := range append(roles, r.selectedRoles()...) {
+		ref := roleRef(role)
+		if !seen[ref.String()] {
+			seen[ref.String()] = true
+			kind := strings.ToLower(ref.kind)
+			t.items[paneRoles] = append(t.items[paneRoles], TUIItem{
+				label:   ref.String(),
+				kind:    kind,
+				ref:     role,
+				focused: r.isFocused(kind, role.namespace, role.name) || r.ruleMatchesSelection(role),
+				missing: !r.roleExists(role),
+			})
+		}
+	}
+	sortTUIItems(t.items[paneRoles])
+
+	for pane := range t.items {
+		if t.selection[pane] >= len(t.items[pane]) {
+			t.selection[pane] = 0
+			t.offset[pane] = 0
+		}
+	}
+}
+
+func sortTUIItems(items []TUIItem) {
+	sort.Slice(items, func(i, j int) bool { return items[i].label < items[j].label })
+}
+
+// namespaces returns the namespaces of all parsed resources
+func (t *TUI) namespaces() []string {
+	p := t.base.permissions
+	found := map[string]bool{}
+	for ns := range p.ServiceAccounts {
+		found[ns] = true
+	}
+	for ns := range p.Roles {
+		found[ns] = true
+	}
+	for ns := range p.RoleBindings {
+		found[ns] = true
+	}
+	for ns := range p.Workloads {
+		found[ns] = true
+	}
+	namespaces := []string{}
+	for ns := range found {
+		if ns != "" {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// handleKey handles a key press (or an escape sequence) and returns false if the user quits
+func (t *TUI) handleKey(key string) bool {
+	if t.prompt != nil {
+		t.handlePromptKey(key)
+		return true
+	}
+	t.status = ""
+	switch key {
+	case "q", "\x03":
+		return false
+	case "\x1b[A", "k":
+		t.move(-1)
+	case "\x1b[B", "j":
+		t.move(1)
+	case "\x1b[5~":
+		t.move(-10)
+	case "\x1b[6~":
+		t.move(10)
+	case "\x1b[D", "h", "\x1b[Z":
+		t.pane = (t.pane + paneCount - 1) % paneCount
+	case "\x1b[C", "l", "\t":
+		t.pane = (t.pane + 1) % paneCount
+	case "\r", "\n":
+		t.follow()
+	case "\x1b", "\x7f", "\b":
+		t.back()
+	case "/":
+		prompt := ""
+		t.prompt = &prompt
+	case "d":
+		t.export()
+	}
+	return true
+}
+
+// splitKeys splits the input read at once (e.g. when pasting or typing fast) into keys, i.e. into characters and
+// escape sequences such as "\x1b[A" (arrow up)
+func splitKeys(input string) []string {
+	keys := []string{}
+	runes := []rune(input)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == '\x1b' && i+1 < len(runes) && runes[i+1] == '[' {
+			end := i + 2
+			for end < len(runes) && (runes[end] < '@' || runes[end] > '~') {
+				end++
+			}
+			if end < len(runes) {
+				keys = append(keys, string(runes[i:end+1]))
+				i = end
+				continue
+			}
+		}
+		keys = append(keys, string(runes[i]))
+	}
+	return keys
+}
+
+func (t *TUI) handlePromptKey(key string) {
+	switch key {
+	case "\x1b", "\x03":
+		t.prompt = nil
+	case "\x7f", "\b":
+		if len(*t.prompt) > 0 {
+			runes := []rune(*t.prompt)
+			*t.prompt = string(runes[:len(runes)-1])
+		}
+	case "\r", "\n":
+		fields := strings.Fields(*t.prompt)
+		t.prompt = nil
+		if len(fields) < 2 || len(fields) > 3 {
+			t.status = "Usage: VERB RESOURCE [NAME]"
+			return
+		}
+		whoCan := WhoCan{verb: fields[0], resourceKind: fields[1], showMatchedOnly: t.base.config.whoCan.showMatchedOnly}
+		if len(fields) == 3 {
+			whoCan.resourceName = fields[2]
+		}
+		t.push(TUIState{namespace: t.state.namespace, whoCan: &whoCan})
+	default:
+		if !strings.HasPrefix(key, "\x1b") && key >= " " {
+			*t.prompt += key
+		}
+	}
+}
+
+func (t *TUI) move(delta int) {
+	count := len(t.items[t.pane])
+	if count == 0 {
+		return
+	}
+	selection := t.selection[t.pane] + delta
+	if selection < 0 {
+		selection = 0
+	} else if selection >= count {
+		selection = count - 1
+	}
+	t.selection[t.pane] = selection
+}
+
+func (t *TUI) selected(pane int) *TUIItem {
+	if t.selection[pane] < len(t.items[pane]) {
+		return &t.items[pane][t.selection[pane]]
+	}
+	return nil
+}
+
+// follow focuses on the selected item: a namespace shows the resources in it, a subject its bindings, a binding its
+// subjects and role, and a role the bindings referring to it
+func (t *TUI) follow() {
+	item := t.selected(t.pane)
+	if item == nil {
+		return
+	}
+	if t.pane == paneNamespaces {
+		t.push(TUIState{namespace: item.ref.namespace})
+		return
+	}
+	t.push(TUIState{namespace: t.state.namespace, focus: KindNamespacedName{item.kind, item.ref}})
+	// move on to the pane the followed link points to
+	switch t.pane {
+	case paneSubjects:
+		t.pane = paneBindings
+	case paneBindings:
+		t.pane = paneRoles
+	}
+}
+
+func (t *TUI) push(state TUIState) {
+	t.history = append(t.history, t.state)
+	t.state = state
+	t.selection = [paneCount]int{}
+	t.offset = [paneCount]int{}
+	t.update()
+}
+
+func (t *TUI) back() {
+	if len(t.history) == 0 {
+		return
+	}
+	t.state = t.history[len(t.history)-1]
+	t.history = t.history[:len(t.history)-1]
+	t.update()
+}
+
+// export writes the graph of the current state (i.e. what `rback` would print with the corresponding arguments) to a file
+func (t *TUI) export() {
+	if err := ioutil.WriteFile(tuiExportFile, []byte(t.rback().genGraph().String()), 0644); err != nil {
+		t.status = fmt.Sprintf("Can't write %s: %v", tuiExportFile, err)
+		return
+	}
+	t.status = "Wrote " + tuiExportFile
+}
+
+// render draws the four panes side by side, the details of the selected item below them and a status line
+func (t *TUI) render(w io.Writer, rows, cols int) {
+	fmt.Fprint(w, "\x1b[H\x1b[2J")
+	detailRows := rows / 3
+	listRows := rows - detailRows - 4 // title, pane headers, separator and status line
+	paneWidth := cols / paneCount
+
+	writeLine(w, "\x1b[7m", padRight(" rback  "+t.describeState(), cols))
+	line := ""
+	for pane := 0; pane < paneCount; pane++ {
+		title := fmt.Sprintf(" %s (%d)", paneTitles[pane], len(t.items[pane]))
+		if pane == t.pane {
+			title = "\x1b[1;4m" + padRight(title, paneWidth-1) + "\x1b[0m "
+		} else {
+			title = padRight(title, paneWidth)
+		}
+		line += title
+	}
+	writeLine(w, "", line)
+
+	for pane := range t.items {
+		if t.selection[pane] < t.offset[pane] {
+			t.offset[pane] = t.selection[pane]
+		} else if t.selection[pane] >= t.offset[pane]+listRows {
+			t.offset[pane] = t.selection[pane] - listRows + 1
+		}
+	}
+	for row := 0; row < listRows; row++ {
+		line := ""
+		for pane := 0; pane < paneCount; pane++ {
+			line += t.cell(pane, t.offset[pane]+row, paneWidth)
+		}
+		writeLine(w, "", line)
+	}
+
+	writeLine(w, "", strings.Repeat("─", cols))
+	details := t.details()
+	for row := 0; row < detailRows; row++ {
+		text := ""
+		if row < len(details) {
+			text = details[row]
+		}
+		writeLine(w, "", " "+truncate(text, cols-1))
+	}
+
+	status := t.status
+	if t.prompt != nil {
+		status = "who-can (VERB RESOURCE [NAME]): " + *t.prompt + "█"
+	} else if status == "" {
+		status = "↑↓ select  ←→ pane  enter follow  esc back  / who-can  d export to " + tuiExportFile + "  q quit"
+	}
+	fmt.Fprint(w, "\x1b[7m"+padRight(" "+status, cols)+"\x1b[0m")
+}
+
+func (t *TUI) describeState() string {
+	description := "namespace " + iff(t.state.namespace == "", "(all)", t.state.namespace)
+	if t.state.whoCan != nil {
+		description += fmt.Sprintf(", who can %s %s %s", t.state.whoCan.verb, t.state.whoCan.resourceKind, t.state.whoCan.resourceName)
+	} else if t.state.focus.kind != "" {
+		description += ", focused on " + t.state.focus.kind + " " + t.state.focus.name
+	}
+	return description
+}
+
+// cell renders an item of a pane, highlighting the selected item and focused items
+func (t *TUI) cell(pane, index, width int) string {
+	if index >= len(t.items[pane]) {
+		return strings.Repeat(" ", width)
+	}
+	item := t.items[pane][index]
+	label := item.label
+	if pane != paneNamespaces {
+		label = item.ref.name
+		if item.ref.namespace != "" && t.state.namespace == "" {
+			label = item.ref.namespace + "/" + label
+		}
+		label = fmt.Sprintf("%-3s %s", tuiKindTags[item.kind], label)
+	}
+	if item.missing {
+		label += " (missing)"
+	}
+	text := padRight(" "+label, width-1)
+	style := ""
+	if item.focused {
+		style += "\x1b[1m"
+	}
+	if item.missing {
+		style += "\x1b[31m"
+	}
+	if index == t.selection[pane] {
+		style += iff(pane == t.pane, "\x1b[7m", "\x1b[4m")
+	}
+	return style + text + "\x1b[0m "
+}
+
+// details describes the item selected in the current pane
+func (t *TUI) details() []string {
+	item := t.selected(t.pane)
+	if item == nil {
+		return nil
+	}
+	r := t.rback()
+	p := t.base.permissions
+	switch t.pane {
+	case paneNamespaces:
+		ns := item.ref.namespace
+		if item.kind == "" && ns == "" {
+			return []string{"All namespaces"}
+		}
+		return []string{
+			"Namespace " + ns,
+			fmt.Sprintf("%d ServiceAccounts, %d Roles, %d RoleBindings, %d workloads",
+				len(p.ServiceAccounts[ns]), len(p.Roles[ns]), len(p.RoleBindings[ns]), len(p.Workloads[ns])),
+		}
+	case paneSubjects:
+		subject, _ := toSubject(item.kind, item.ref.namespace, item.ref.name)
+		lines := []string{subject.String()}
+		all := *r
+		all.config.namespaces = []string{""}
+		grants := all.whatCanGrants(subject)
+		for _, grant := range grants {
+			lines = append(lines, fmt.Sprintf("  %s -> %s", grant.Binding, grant.Role))
+		}
+		if len(grants) == 0 {
+			lines = append(lines, "  not bound to any role")
+		}
+		for _, workload := range p.Workloads[subject.namespace] {
+			if subject.kind == "ServiceAccount" && workload.serviceAccount == subject.name {
+				lines = append(lines, "  used by "+workload.KindNamespacedName.String())
+			}
+		}
+		return lines
+	case paneBindings:
+		binding := p.RoleBindings[item.ref.namespace][item.ref.name]
+		return []string{
+			bindingRef(binding).String(),
+			"  role:     " + roleRef(binding.role).String() + iff(r.roleExists(binding.role), "", " (missing)"),
+			"  subjects: " + subjectList(binding.subjects),
+		}
+	case paneRoles:
+		lines := []string{roleRef(item.ref).String()}
+		role, found := p.Roles[item.ref.namespace][item.ref.name]
+		if !found {
+			return append(lines, "  (missing)")
+		}
+		for _, rule := range r.renderedRules(role) {
+			text := "  " + rule.toHumanReadableString()
+			if r.config.resourceKind == kindRule && r.config.whoCan.matches(rule) {
+				text = "\x1b[1m" + text + "\x1b[0m"
+			} else if r.config.whoCan.showMatchedOnly && r.config.resourceKind == kindRule {
+				continue
+			}
+			lines = append(lines, text)
+		}
+		return lines
+	}
+	return nil
+}
+
+func writeLine(w io.Writer, style, text string) {
+	fmt.Fprint(w, style+text+"\x1b[0m\r\n")
+}
+
+// truncate shortens text to the given number of runes (not counting ANSI escape sequences)
+func truncate(text string, width int) string {
+	result, count, escaped := []rune{}, 0, false
+	for _, r := range text {
+		if r == '\x1b' {
+			escaped = true
+		}
+		if !escaped {
+			if count == width {
+				break
+			}
+			count++
+		}
+		if escaped && r == 'm' {
+			escaped = false
+		}
+		result = append(result, r)
+	}
+	return string(result)
+}
+
+func padRight(text string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	runes := []rune(text)
+	if len(runes) > width {
+		return string(runes[:width-1]) + "…"
+	}
+	return text + strings.Repeat(" ", width-len(runes))
+}
+
+// rawTerminal switches the terminal to raw mode (with stty, so that no terminal library is needed) and returns a func
+// restoring the previous mode
+func rawTerminal() (func(), error) {
+	state, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, err
+	}
+	return func() { stty(strings.TrimSpace(state)) }, nil
+}
+
+func terminalSize() (rows, cols int) {
+	out, err := stty("size")
+	fields := strings.Fields(out)
+	if err != nil || len(fields) != 2 {
+		return 24, 80
+	}
+	rows, _ = strconv.Atoi(fields[0])
+	cols, _ = strconv.Atoi(fields[1])
+	if rows < 10 || cols < 40 {
+		return 24, 80
+	}
+	return rows, cols
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
@@ -4,12 +4,18 @@ type Permissions struct {
 	ServiceAccounts map[string]map[string]string  // map[namespace]map[name]json
 	Roles           map[string]map[string]Role    // ClusterRoles are stored in Roles[""]
 	RoleBindings    map[string]map[string]Binding // ClusterRoleBindings are stored in RoleBindings[""]
+	Sources         map[KindNamespacedName]SourcePosition
+	Metadata        map[KindNamespacedName]ObjectMeta
+	Workloads       map[string][]Workload // map[namespace]workloads
 }
 
 type Binding struct {
 	NamespacedName
 	role     NamespacedName
 	subjects []KindNamespacedName
+	// ignoredSubjects are the subjects left out by --ignore-prefixes (e.g. the system:serviceaccounts groups), which are
+	// still needed to find the bindings of ServiceAccounts
+	ignoredSubjects []KindNamespacedName
 }
 
 type Role struct {
@@ -17,6 +23,13 @@ type Role struct {
 	rules []Rule
 }
 
+// Workload is a Pod or a controller creating Pods (e.g. a Deployment) that runs as a ServiceAccount
+type Workload struct {
+	KindNamespacedName
+	serviceAccount string
+	automountToken *bool // nil if the Pod spec doesn't set automountServiceAccountToken
+}
+
 type NamespacedName struct {
 	namespace string
 	name      string
@@ -27,6 +40,20 @@ type KindNamespacedName struct {
 	NamespacedName
 }
 
+// SourcePosition is where an object was found in the input (file is empty when reading from stdin)
+type SourcePosition struct {
+	file   string
+	line   int
+	column int
+}
+
+// ObjectMeta is the metadata of an object other than its kind, namespace and name
+type ObjectMeta struct {
+	labels            map[string]string
+	annotations       map[string]string
+	creationTimestamp string
+}
+
 type Rule struct {
 	verbs           []string
 	resources       []string
@@ -34,3 +61,10 @@ type Rule struct {
 	nonResourceURLs []string
 	apiGroups       []string
 }
+
+func (o KindNamespacedName) String() string {
+	if o.namespace == "" {
+		return o.kind + " " + o.name
+	}
+	return o.kind + " " + o.namespace + "/" + o.name
+}
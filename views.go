@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/emicklei/dot"
+)
+
+const (
+	viewFull     = "full"
+	viewSubjects = "subjects"
+	viewRoles    = "roles"
+)
+
+func validView(view string) bool {
+	return view == viewFull || view == viewSubjects || view == viewRoles
+}
+
+// genSubjectsGraph draws each subject with a single table of its effective access rules, grouped by the namespace
+// they apply in, instead of drawing its bindings and roles
+func (r *Rback) genSubjectsGraph() *dot.Graph {
+	g := newGraph(r.config.theme)
+
+	subjects, bindingsBySubject := r.selectedSubjects()
+	rulesBySubject := map[KindNamespacedName]map[string][]string{} // map[subject]map[namespace]rules
+	for _, subject := range subjects {
+		rulesBySubject[subject] = map[string][]string{}
+		for _, binding := range bindingsBySubject[subject] {
+			rulesBySubject[subject][binding.namespace] = r.appendEffectiveRules(rulesBySubject[subject][binding.namespace], binding)
+		}
+	}
+
+	for _, subject := range subjects {
+		gns := newNamespaceSubgraph(g, r.config.theme, subject.namespace)
+		subjectNode := r.newSubjectNode(gns, subject.kind, subject.namespace, subject.name)
+		if r.config.showRules {
+			permissionsNode := newPermissionsNode0(gns, subject.kind, subject.namespace, subject.name, permissionsTable(rulesBySubject[subject]))
+			newSubjectToPermissionsEdge(r.config.theme, subjectNode, permissionsNode)
+		}
+	}
+	return g
+}
+
+// selectedSubjects returns the subjects of all rendered bindings (sorted by kind, namespace and name), together with
+// the rendered bindings of each subject
+func (r *Rback) selectedSubjects() ([]KindNamespacedName, map[KindNamespacedName][]Binding) {
+	subjects := []KindNamespacedName{}
+	bindingsBySubject := map[KindNamespacedName][]Binding{}
+	for _, bindings := range r.permissions.RoleBindings {
+		for _, binding := range bindings {
+			if !r.shouldRenderBinding(binding) {
+				continue
+			}
+			for _, subject := range binding.subjects {
+				if !r.shouldRenderSubject(subject) {
+					continue
+				}
+				if bindingsBySubject[subject] == nil {
+					subjects = append(subjects, subject)
+				}
+				bindingsBySubject[subject] = append(bindingsBySubject[subject], binding)
+			}
+		}
+	}
+	sort.Slice(subjects, func(i, j int) bool {
+		a, b := subjects[i], subjects[j]
+		if a.kind != b.kind {
+			return a.kind < b.kind
+		}
+		if a.namespace != b.namespace {
+			return a.namespace < b.namespace
+		}
+		return a.name < b.name
+	})
+	return subjects, bindingsBySubject
+}
+
+// appendEffectiveRules appends the rendered access rules granted by the binding (skipping duplicates)
+func (r *Rback) appendEffectiveRules(lines []string, binding Binding) []string {
+	role, found := r.permissions.Roles[binding.role.namespace][binding.role.name]
+	if !found {
+		line := regularLine(fmt.Sprintf("(missing %v)", roleRef(binding.role)))
+		if !contains(lines, line) {
+			lines = append(lines, line)
+		}
+		return lines
+	}
+	for _, rule := range r.renderedRules(role) {
+		line := regularLine(rule.toHumanReadableString())
+		if r.config.resourceKind == kindRule && r.config.whoCan.matches(rule) {
+			line = boldLine(rule.toHumanReadableString())
+		}
+		if !contains(lines, line) {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// permissionsTable renders a HTML table with one row per namespace (cluster-wide rules first)
+func permissionsTable(rulesByNamespace map[string][]string) string {
+	namespaces := []string{}
+	for ns := range rulesByNamespace {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	table := `<table border="0" cellborder="1" cellspacing="0" cellpadding="4">`
+	for _, ns := range namespaces {
+		table += fmt.Sprintf(`<tr><td valign="top"><i>%s</i></td><td align="left" balign="left">%s</td></tr>`,
+			escapeHTML(iff(ns == "", "cluster-wide", ns)), strings.Join(rulesByNamespace[ns], ""))
+	}
+	return table + `</table>`
+}
+
+// genRolesGraph draws bindings, roles and access rules, but replaces the subjects of each binding by their counts
+func (r *Rback) genRolesGraph() *dot.Graph {
+	g := newGraph(r.config.theme)
+	for _, bindings := range r.permissions.RoleBindings {
+		for _, binding := range bindings {
+			if !r.shouldRenderBinding(binding) {
+				continue
+			}
+
+			gns := newNamespaceSubgraph(g, r.config.theme, binding.namespace)
+
+			bindingNode := r.newBindingNode(gns, binding)
+			bindingNode.Attr("label", formatLabel(binding.name+"\n"+subjectCounts(binding.subjects),
+				r.isFocused(strings.ToLower(bindingRef(binding).kind), binding.namespace, binding.name)))
+			roleNode := r.newRoleAndRulesNodePair(gns, binding.namespace, binding.role)
+
+			newBindingToRoleEdge(r.config.theme, bindingNode, roleNode)
+		}
+	}
+	return g
+}
+
+// subjectCounts summarizes subjects by kind, e.g. "2 ServiceAccounts, 1 User"
+func subjectCounts(subjects []KindNamespacedName) string {
+	if len(subjects) == 0 {
+		return "no subjects"
+	}
+	counts := map[string]int{}
+	kinds := []string{}
+	for _, subject := range subjects {
+		if counts[subject.kind] == 0 {
+			kinds = append(kinds, subject.kind)
+		}
+		counts[subject.kind]++
+	}
+	sort.Strings(kinds)
+
+	result := []string{}
+	for _, kind := range kinds {
+		result = append(result, fmt.Sprintf("%d %s%s", counts[kind], kind, iff(counts[kind] == 1, "", "s")))
+	}
+	return strings.Join(result, ", ")
+}
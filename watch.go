@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// watchedKinds are the kinds watched in the cluster
+var watchedKinds = []string{"serviceaccounts", "roles", "rolebindings", "clusterroles", "clusterrolebindings"}
+
+const (
+	fileWatchInterval = 2 * time.Second
+	watchQuietPeriod  = 500 * time.Millisecond // changes arriving within this period are applied together
+)
+
+// ObjectChange is an added, modified or deleted object
+type ObjectChange struct {
+	object  KindNamespacedName
+	item    map[string]interface{} // nil if the object was deleted
+	source  SourcePosition
+	deleted bool
+}
+
+// Watcher reports changes of the RBAC resources in the input file or cluster. It remembers a fingerprint of each
+// object, so that only objects that actually changed are reported.
+type Watcher struct {
+	config       Config
+	fingerprints map[KindNamespacedName]string
+	changes      chan ObjectChange
+}
+
+// newWatcher creates a watcher, taking the fingerprints of the objects in the initially loaded input
+func newWatcher(config Config, input []byte) (*Watcher, error) {
+	w := &Watcher{config: config, fingerprints: map[KindNamespacedName]string{}, changes: make(chan ObjectChange)}
+	_, items, _, err := decodeList(input)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		w.fingerprints[objectRef(item)] = fingerprint(item)
+	}
+	return w, nil
+}
+
+// watch starts watching the cluster (with kubectl) or the input file and calls apply with each batch of changes. It
+// only returns if watching fails.
+func (w *Watcher) watch(apply func(changes []ObjectChange)) error {
+	errors := make(chan error, len(watchedKinds))
+	if w.config.fromCluster {
+		for _, kind := range watchedKinds {
+			go func(kind string) { errors <- w.watchCluster(kind) }(kind)
+		}
+	} else {
+		loaded := w.objects()
+		go func() { errors <- w.watchFile(loaded) }()
+	}
+
+	batch := map[KindNamespacedName]ObjectChange{}
+	order := []KindNamespacedName{}
+	quiet := time.NewTimer(watchQuietPeriod)
+	quiet.Stop()
+	for {
+		select {
+		case change := <-w.changes:
+			if !w.changed(change) {
+				continue
+			}
+			if _, found := batch[change.object]; !found {
+				order = append(order, change.object)
+			}
+			batch[change.object] = change
+			// drain the channel if the timer fired meanwhile, so that a stale tick doesn't end the quiet period early
+			if !quiet.Stop() {
+				select {
+				case <-quiet.C:
+				default:
+				}
+			}
+			quiet.Reset(watchQuietPeriod)
+		case <-quiet.C:
+			changes := []ObjectChange{}
+			for _, object := range order {
+				changes = append(changes, batch[object])
+			}
+			batch, order = map[KindNamespacedName]ObjectChange{}, []KindNamespacedName{}
+			apply(changes)
+		case err := <-errors:
+			return err
+		}
+	}
+}
+
+// changed updates the fingerprint of the changed object and returns false if the object is unchanged
+func (w *Watcher) changed(change ObjectChange) bool {
+	previous, found := w.fingerprints[change.object]
+	if change.deleted {
+		delete(w.fingerprints, change.object)
+		return found
+	}
+	current := fingerprint(change.item)
+	w.fingerprints[change.object] = current
+	return !found || previous != current
+}
+
+// objects returns the objects fingerprinted so far
+func (w *Watcher) objects() map[KindNamespacedName]bool {
+	objects := map[KindNamespacedName]bool{}
+	for object := range w.fingerprints {
+		objects[object] = true
+	}
+	return objects
+}
+
+// watchFile polls the input file for modifications and reports the objects that were added, modified or removed. The
+// fingerprints belong to the goroutine running watch, so removed objects are found by comparing the objects in the
+// file with the ones found in it before (starting with the loaded ones).
+func (w *Watcher) watchFile(previous map[KindNamespacedName]bool) error {
+	info, err := os.Stat(w.config.inputFile)
+	if err != nil {
+		return err
+	}
+	for range time.Tick(fileWatchInterval) {
+		current, err := os.Stat(w.config.inputFile)
+		if err != nil {
+			log.Printf("Can't check %s for changes: %v", w.config.inputFile, err)
+			continue
+		}
+		if current.ModTime() == info.ModTime() && current.Size() == info.Size() {
+			continue
+		}
+		info = current
+
+		data, err := ioutil.ReadFile(w.config.inputFile)
+		if err != nil {
+			log.Printf("Can't read %s: %v", w.config.inputFile, err)
+			continue
+		}
+		_, items, offsets, err := decodeList(data)
+		if err != nil {
+			log.Printf("Can't parse %s: %v", w.config.inputFile, err)
+			continue
+		}
+		present := map[KindNamespacedName]bool{}
+		locator := newSourceLocator(w.config.inputFile, data)
+		for i, item := range items {
+			object := objectRef(item)
+			present[object] = true
+			w.changes <- ObjectChange{object: object, item: item, source: locator.position(offsets[i])}
+		}
+		for object := range previous {
+			if !present[object] {
+				w.changes <- ObjectChange{object: object, deleted: true}
+			}
+		}
+		previous = present
+	}
+	return nil
+}
+
+// watchCluster watches the objects of the given kind in all namespaces with kubectl and reports each watch event
+func (w *Watcher) watchCluster(kind string) error {
+	cmd := exec.Command("kubectl", "get", kind, "--all-namespaces", "--watch", "--output-watch-events", "-o", "json")
+	cmd.Stderr = os.Stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bufio.NewReader(out))
+	for {
+		var event struct {
+			Type   string                 `json:"type"`
+			Object map[string]interface{} `json:"object"`
+		}
+		if err := decoder.Decode(&event); err != nil {
+			cmd.Wait()
+			return fmt.Errorf("Watching %s failed: %v", kind, err)
+		}
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			w.changes <- ObjectChange{object: objectRef(event.Object), item: event.Object}
+		case "DELETED":
+			w.changes <- ObjectChange{object: objectRef(event.Object), deleted: true}
+		}
+	}
+}
+
+func objectRef(item map[string]interface{}) KindNamespacedName {
+	kind, _ := item["kind"].(string)
+	return KindNamespacedName{kind, getNamespacedName(getMetadata(item))}
+}
+
+// fingerprint returns the object's canonical JSON (encoding/json sorts map keys)
+func fingerprint(item map[string]interface{}) string {
+	data, _ := json.Marshal(item)
+	return string(data)
+}
+
+// applyChanges applies the changed objects to r.permissions and drops everything computed from the previous objects
+func (r *Rback) applyChanges(changes []ObjectChange) {
+	for _, change := range changes {
+		if change.deleted {
+			r.deleteObject(change.object)
+		} else {
+			r.applyObject(change.item, change.source)
+		}
+	}
+	r.riskScores = nil
+	r.auditHitCounts = nil
+	r.focusNeighborhood = nil
+	r.metadataColors = nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/emicklei/dot"
+)
+
+// newWorkloadNodes draws the workloads running as the given ServiceAccount and links them to its node
+func (r *Rback) newWorkloadNodes(gns *dot.Graph, saNode dot.Node, ns, sa string) {
+	for _, workload := range r.permissions.Workloads[ns] {
+		if workload.serviceAccount == sa {
+			workloadNode := newWorkloadNode0(r.groupSubgraph(gns, ns, workload.KindNamespacedName), r.config.theme, workload.kind, ns, workload.name, r.mountsToken(workload), false)
+			r.applyMetadataColor(workloadNode, workload.KindNamespacedName)
+			r.applyLink(workloadNode, workload.KindNamespacedName)
+			newWorkloadToSubjectEdge(r.config.theme, workloadNode, saNode)
+		}
+	}
+}
+
+// mountsToken returns true if the workload's Pods get the ServiceAccount token mounted. The Pod spec's
+// automountServiceAccountToken takes precedence over the ServiceAccount's.
+func (r *Rback) mountsToken(workload Workload) bool {
+	if workload.automountToken != nil {
+		return *workload.automountToken
+	}
+	if sa, found := r.permissions.ServiceAccounts[workload.namespace][workload.serviceAccount]; found {
+		return automountsToken(sa)
+	}
+	return true
+}
+
+func (r *Rback) hasWorkloads() bool {
+	for _, workloads := range r.permissions.Workloads {
+		if len(workloads) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// hasWorkloadsIn returns true if the input contains workloads in the given namespace
+func (r *Rback) hasWorkloadsIn(ns string) bool {
+	return len(r.permissions.Workloads[ns]) > 0
+}
+
+// serviceAccountUsed returns true if any workload runs as the given ServiceAccount
+func (r *Rback) serviceAccountUsed(ns string, name string) bool {
+	for _, workload := range r.permissions.Workloads[ns] {
+		if workload.serviceAccount == name {
+			return true
+		}
+	}
+	return false
+}
+
+// lintServiceAccounts flags ServiceAccounts no workload runs as and workloads running as a default ServiceAccount
+// that has bindings. ServiceAccounts are only flagged as unused in namespaces the input contains workloads of, since
+// workloads may not have been loaded for the other namespaces.
+func (r *Rback) lintServiceAccounts() []Finding {
+	findings := []Finding{}
+	for ns, sas := range r.permissions.ServiceAccounts {
+		if !r.namespaceSelected(ns) || !r.hasWorkloadsIn(ns) {
+			continue
+		}
+		for sa := range sas {
+			if sa != "default" && !r.serviceAccountUsed(ns, sa) {
+				findings = append(findings, Finding{
+					ruleID:      "unused-serviceaccount",
+					description: lintCheckDescription("unused-serviceaccount"),
+					severity:    severityWarning,
+					message:     "is not used by any Pod or controller",
+					object:      KindNamespacedName{"ServiceAccount", NamespacedName{ns, sa}},
+				})
+			}
+		}
+	}
+
+	for ns, workloads := range r.permissions.Workloads {
+		if !r.namespaceSelected(ns) {
+			continue
+		}
+		defaultSA := KindNamespacedName{"ServiceAccount", NamespacedName{ns, "default"}}
+		defaultSABindings := r.bindingsOf(defaultSA)
+		if len(defaultSABindings) == 0 {
+			continue
+		}
+		for _, workload := range workloads {
+			if workload.serviceAccount == "default" {
+				findings = append(findings, Finding{
+					ruleID:      "default-serviceaccount-in-use",
+					description: lintCheckDescription("default-serviceaccount-in-use"),
+					severity:    severityWarning,
+					message:     fmt.Sprintf("runs as %v, which is bound by %s", defaultSA, bindingList(defaultSABindings)),
+					object:      workload.KindNamespacedName,
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// bindingsOf returns all bindings that bind the ServiceAccount directly or through its implicit groups. The groups are
+// also looked up among the subjects ignored by --ignore-prefixes, as the default prefix system: covers them.
+func (r *Rback) bindingsOf(sa KindNamespacedName) []Binding {
+	groups := []string{"system:serviceaccounts", "system:serviceaccounts:" + sa.namespace}
+	result := []Binding{}
+	for _, bindings := range r.permissions.RoleBindings {
+		for _, binding := range bindings {
+			if bindsSubject(binding, sa, groups) || bindsSubject(Binding{subjects: binding.ignoredSubjects}, sa, groups) {
+				result = append(result, binding)
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return bindingRef(result[i]).String() < bindingRef(result[j]).String()
+	})
+	return result
+}
+
+func bindingList(bindings []Binding) string {
+	result := ""
+	for i, binding := range bindings {
+		if i > 0 {
+			result += ", "
+		}
+		result += bindingRef(binding).String()
+	}
+	return result
+}